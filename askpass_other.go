@@ -0,0 +1,17 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package get
+
+// An askpass bridges an askpass program to a function in this process.
+type askpass struct {
+	program string
+}
+
+// newAskpass returns nil: without FIFOs there is no bridge, and commands
+// run as they do outside interactive mode.
+func newAskpass(ask func(prompt string) (string, error)) (*askpass, error) {
+	return nil, nil
+}
+
+func (a *askpass) close() {}
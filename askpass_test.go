@@ -0,0 +1,23 @@
+package get
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestAskpassBridge checks that systems with FIFOs build the askpass bridge,
+// not the stub that leaves Interactive without effect.
+func TestAskpassBridge(t *testing.T) {
+	switch runtime.GOOS {
+	case "android", "darwin", "dragonfly", "freebsd", "ios", "linux", "netbsd", "openbsd":
+	default:
+		t.Skipf("no askpass bridge on %s", runtime.GOOS)
+	}
+	a, err := newAskpass(func(prompt string) (string, error) { return "", nil })
+	require.NoError(t, err)
+	require.NotNil(t, a, "askpass bridge not built for %s", runtime.GOOS)
+	defer a.close()
+	require.NotEmpty(t, a.program)
+}
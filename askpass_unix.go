@@ -0,0 +1,101 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package get
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// askpassScript is the askpass program. It sends its prompt, terminated by
+// a NUL byte, through the prompt FIFO, and reads the reply from the answer
+// FIFO: "+" and the answer, or "-" if there is none. Commands ask one
+// question at a time, so replies can't be crossed.
+const askpassScript = `#!/bin/sh
+dir=%s
+printf '%%s\000' "$1" > "$dir/prompt" || exit 1
+IFS= read -r reply < "$dir/answer" || exit 1
+case "$reply" in
++*) printf '%%s\n' "${reply#+}" ;;
+*) exit 1 ;;
+esac
+`
+
+// An askpass bridges an askpass program to a function in this process.
+type askpass struct {
+	dir     string
+	program string
+	prompts *os.File
+	answers *os.File
+	done    chan struct{}
+}
+
+func newAskpass(ask func(prompt string) (string, error)) (a *askpass, err error) {
+	dir, err := ioutil.TempDir("", "go-get-askpass")
+	if err != nil {
+		return nil, err
+	}
+	a = &askpass{dir: dir, program: filepath.Join(dir, "askpass"), done: make(chan struct{})}
+	defer func() {
+		if err != nil {
+			a.prompts.Close()
+			a.answers.Close()
+			os.RemoveAll(dir)
+		}
+	}()
+
+	script := fmt.Sprintf(askpassScript, shellQuote(dir))
+	if err := ioutil.WriteFile(a.program, []byte(script), 0700); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"prompt", "answer"} {
+		if err := syscall.Mkfifo(filepath.Join(dir, name), 0600); err != nil {
+			return nil, &os.PathError{Op: "mkfifo", Path: filepath.Join(dir, name), Err: err}
+		}
+	}
+	// Opening both FIFOs for reading and writing never blocks, and keeps
+	// them open between prompts, so the script never sees a closed pipe.
+	if a.prompts, err = os.OpenFile(filepath.Join(dir, "prompt"), os.O_RDWR, 0); err != nil {
+		return nil, err
+	}
+	if a.answers, err = os.OpenFile(filepath.Join(dir, "answer"), os.O_RDWR, 0); err != nil {
+		return nil, err
+	}
+	go a.serve(ask)
+	return a, nil
+}
+
+// serve answers prompts until the bridge is closed.
+func (a *askpass) serve(ask func(prompt string) (string, error)) {
+	defer close(a.done)
+	r := bufio.NewReader(a.prompts)
+	for {
+		prompt, err := r.ReadString(0)
+		if err != nil {
+			return
+		}
+		reply := "-\n"
+		answer, err := ask(strings.TrimSuffix(prompt, "\x00"))
+		if err == nil && !strings.ContainsAny(answer, "\n\x00") {
+			reply = "+" + answer + "\n"
+		}
+		if _, err := io.WriteString(a.answers, reply); err != nil {
+			return
+		}
+	}
+}
+
+// close stops the bridge and removes the program.
+func (a *askpass) close() {
+	a.prompts.Close()
+	<-a.done
+	a.answers.Close()
+	os.RemoveAll(a.dir)
+}
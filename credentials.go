@@ -0,0 +1,122 @@
+package get
+
+import (
+	urlpkg "net/url"
+	"sort"
+
+	"github.com/tilt-dev/go-get/internal/auth"
+	"github.com/tilt-dev/go-get/internal/web"
+)
+
+// A CredentialProvider supplies the credentials for requests to a server.
+// A Downloader consults it for every HTTPS request it makes itself and
+// for every git command that talks to an HTTPS repository, so changes
+// to the credentials take effect without a restart.
+type CredentialProvider = auth.Provider
+
+// Credentials authenticate requests to a server, with basic
+// authentication or with arbitrary headers.
+type Credentials = auth.Credentials
+
+// NetrcCredentials supplies the credentials in a .netrc file,
+// reading it again whenever it changes.
+type NetrcCredentials = auth.Netrc
+
+// EnvTokenCredentials supplies a token read from an environment
+// variable on every request.
+type EnvTokenCredentials = auth.EnvToken
+
+// HeaderCredentials sends headers, such as a bearer token or GitLab's
+// PRIVATE-TOKEN, read from environment variables or files, to the hosts
+// matching each rule's patterns. Git is sent them through http.extraHeader
+// in its environment, so they are never written to .git/config.
+type HeaderCredentials = auth.Headers
+
+// HeaderRule is a rule of HeaderCredentials.
+type HeaderRule = auth.HeaderRule
+
+// StaticCredentials holds fixed credentials, keyed by host.
+type StaticCredentials = auth.Static
+
+// GitCredentialHelper supplies the credentials from the user's git
+// credential helpers, through git credential fill. The Downloader
+// approves them when a server accepts them and rejects them when it
+// refuses them, as git does.
+type GitCredentialHelper = auth.GitHelper
+
+// GoAuthCredentials supplies credentials as the go command's GOAUTH
+// setting does, from .netrc, git credential helpers or commands that
+// print headers for URL prefixes. A Downloader without Credentials
+// uses it with $GOAUTH. See 'go help goauth'.
+type GoAuthCredentials = auth.GoAuth
+
+// CredentialChain consults each of its providers in turn,
+// returning the first credentials found.
+type CredentialChain = auth.Chain
+
+// defaultCredentials returns the provider for the HTTP requests of a
+// Downloader without Credentials: $GOAUTH, with its warnings logged.
+func (d *Downloader) defaultCredentials() *GoAuthCredentials {
+	if d.Credentials != nil {
+		return nil
+	}
+	if d.goAuth == nil {
+		d.goAuth = &GoAuthCredentials{Warn: func(msg string, keyvals ...interface{}) {
+			if l := d.logger(); l != nil {
+				l.Log(LevelWarn, msg, redactKeyvals(keyvals)...)
+			}
+		}}
+	}
+	return d.goAuth
+}
+
+// webClient returns the client for the HTTP requests made for ctx.
+func (ctx cmdContext) webClient() *web.Client {
+	client := &web.Client{Credentials: ctx.credentials, Config: ctx.http}
+	if ctx.credentials == nil && ctx.goAuth != nil {
+		client.Credentials = ctx.goAuth
+	}
+	if ctx.httpCache != "" {
+		client.Cache = &web.Cache{Dir: ctx.httpCache, Warn: func(msg string, keyvals ...interface{}) {
+			ctx.log(LevelWarn, msg, keyvals...)
+		}}
+	}
+	return client
+}
+
+// credentialEnv returns the environment that has git send the credentials
+// for repo, if it is an HTTPS repository, as extra HTTP headers. env is the
+// rest of the command's environment, whose git configuration is kept.
+//
+// Only git is given credentials this way. Without a provider, git finds
+// its own, from .netrc or its credential helpers.
+func (ctx cmdContext) credentialEnv(v *vcsCmd, env []string, repo string) ([]string, error) {
+	if ctx.credentials == nil || v.cmd != "git" || repo == "" {
+		return nil, nil
+	}
+	u, err := urlpkg.Parse(repo)
+	if err != nil || u.Scheme != "https" {
+		return nil, nil
+	}
+	creds, err := ctx.credentials.Credentials(u)
+	if err != nil || creds == nil {
+		return nil, err
+	}
+
+	headers := creds.Headers()
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// An empty value first clears the headers configured for the
+	// server elsewhere, so that they don't conflict.
+	key := "http.https://" + u.Host + "/.extraHeader"
+	config := []string{key, ""}
+	for _, name := range names {
+		for _, value := range headers[name] {
+			config = append(config, key, name+": "+value)
+		}
+	}
+	return gitConfigEnv(env, config...), nil
+}
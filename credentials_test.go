@@ -0,0 +1,186 @@
+package get
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	urlpkg "net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const credTestRoot = "github.com/tilt-dev/cred-test"
+
+// installFromURL installs the latest commit of repo, served at url,
+// through a lockfile, which names the repository URL directly.
+func installFromURL(t *testing.T, d *Downloader, url, repo string) error {
+	t.Helper()
+	hash, err := HashDir(repo, "")
+	require.NoError(t, err)
+	lockFile := filepath.Join(tmpdir(t), "lock.json")
+	writeLock(t, lockFile, Lock{Packages: []LockedPackage{{
+		ImportPath: credTestRoot,
+		Repo:       url,
+		VCS:        "git",
+		Root:       credTestRoot,
+		Revision:   runGit(t, repo, "rev-parse", "HEAD"),
+		Hash:       hash,
+	}}})
+	return d.InstallFromLock(lockFile)
+}
+
+// gitStderr returns the standard error of the command that failed with err.
+func gitStderr(err error) string {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(exitErr.Stderr)
+	}
+	return ""
+}
+
+// credDownloader returns a Downloader that trusts the test server.
+func credDownloader(t *testing.T, creds CredentialProvider) *Downloader {
+	d := NewDownloader(setupDir(t))
+	d.Env.Extra = []string{"GIT_SSL_NO_VERIFY=1"}
+	d.Credentials = creds
+	return d
+}
+
+func TestCredentialsGit(t *testing.T) {
+	// Keep the user's credential helpers out of it.
+	setenv(t, "HOME", tmpdir(t))
+	setenv(t, "GIT_CONFIG_NOSYSTEM", "1")
+
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	url := gitHTTPSServer(t, repo, func(r *http.Request) bool {
+		user, pass, ok := r.BasicAuth()
+		return ok && user == "alice" && pass == "secret"
+	})
+	u, err := urlpkg.Parse(url)
+	require.NoError(t, err)
+
+	err = installFromURL(t, credDownloader(t, nil), url, repo)
+	assert.Contains(t, gitStderr(err), "could not read Username")
+
+	creds := StaticCredentials{u.Host: {Username: "alice", Password: "secret"}}
+	d := credDownloader(t, creds)
+	require.NoError(t, installFromURL(t, d, url, repo))
+	assert.Equal(t, "v1", readFile(t, filepath.Join(d.DestinationPath(credTestRoot), "Tiltfile")))
+
+	// The credentials aren't left in the checkout's configuration.
+	config := readFile(t, filepath.Join(d.DestinationPath(credTestRoot), ".git", "config"))
+	assert.NotContains(t, config, "Authorization")
+}
+
+func TestCredentialsGitEnvToken(t *testing.T) {
+	setenv(t, "HOME", tmpdir(t))
+	setenv(t, "GIT_CONFIG_NOSYSTEM", "1")
+
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	url := gitHTTPSServer(t, repo, func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer fresh"
+	})
+	u, err := urlpkg.Parse(url)
+	require.NoError(t, err)
+	creds := CredentialChain{
+		StaticCredentials{"example.com": {Username: "bob"}},
+		&EnvTokenCredentials{Var: "GO_GET_TEST_TOKEN", Hosts: []string{u.Hostname()}},
+	}
+
+	setenv(t, "GO_GET_TEST_TOKEN", "stale")
+	err = installFromURL(t, credDownloader(t, creds), url, repo)
+	assert.Contains(t, gitStderr(err), "could not read Username")
+
+	// A new token is used as soon as it is set.
+	setenv(t, "GO_GET_TEST_TOKEN", "fresh")
+	require.NoError(t, installFromURL(t, credDownloader(t, creds), url, repo))
+}
+
+func TestCredentialsGitHeaders(t *testing.T) {
+	setenv(t, "HOME", tmpdir(t))
+	setenv(t, "GIT_CONFIG_NOSYSTEM", "1")
+
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	url := gitHTTPSServer(t, repo, func(r *http.Request) bool {
+		return r.Header.Get("Private-Token") == "glpat-secret"
+	})
+	u, err := urlpkg.Parse(url)
+	require.NoError(t, err)
+	tokenFile := filepath.Join(tmpdir(t), "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("glpat-secret\n"), 0600))
+	creds := HeaderCredentials{
+		{Hosts: "example.com", Env: "GO_GET_TEST_TOKEN", Prefix: "Bearer"},
+		{Hosts: u.Hostname(), Name: "PRIVATE-TOKEN", File: tokenFile},
+	}
+
+	var records []logRecord
+	d := credDownloader(t, creds)
+	d.Logger = recordLogger(&records)
+	require.NoError(t, installFromURL(t, d, url, repo))
+	assert.Equal(t, "v1", readFile(t, filepath.Join(d.DestinationPath(credTestRoot), "Tiltfile")))
+
+	// The token is neither kept in the checkout nor logged.
+	config := readFile(t, filepath.Join(d.DestinationPath(credTestRoot), ".git", "config"))
+	assert.NotContains(t, config, "glpat-secret")
+	require.NotEmpty(t, records)
+	for _, r := range records {
+		assert.NotContains(t, fmt.Sprint(r.msg, r.keyvals), "glpat-secret")
+	}
+}
+
+func TestCredentialsNetrcReload(t *testing.T) {
+	netrc := filepath.Join(tmpdir(t), "netrc")
+	creds := &NetrcCredentials{Path: netrc}
+	u := &urlpkg.URL{Scheme: "https", Host: "example.com"}
+
+	c, err := creds.Credentials(u)
+	require.NoError(t, err)
+	assert.Nil(t, c)
+
+	require.NoError(t, ioutil.WriteFile(netrc, []byte("machine example.com login alice password one\n"), 0600))
+	c, err = creds.Credentials(u)
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	assert.Equal(t, "one", c.Password)
+
+	require.NoError(t, ioutil.WriteFile(netrc, []byte("machine example.com login alice password second\n"), 0600))
+	c, err = creds.Credentials(u)
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	assert.Equal(t, "second", c.Password)
+}
+
+func TestCredentialsNetrcWarning(t *testing.T) {
+	netrc := filepath.Join(tmpdir(t), "netrc")
+	require.NoError(t, ioutil.WriteFile(netrc, []byte("default login alice password secret\n"), 0644))
+	require.NoError(t, os.Chmod(netrc, 0644))
+	setenv(t, "NETRC", netrc)
+	setenv(t, "GOAUTH", "")
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	var records []logRecord
+	d := NewDownloader(setupDir(t))
+	d.Logger = recordLogger(&records)
+	_, _ = d.toCmdContext("", "").webClient().GetBytes(&urlpkg.URL{Scheme: "https", Host: server.Listener.Addr().String()})
+	require.Len(t, records, 1)
+	assert.Equal(t, LevelWarn, records[0].level)
+	assert.Equal(t, netrc, records[0].keyvals["path"])
+}
+
+func TestGitConfigEnv(t *testing.T) {
+	env := []string{"GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=a.b", "GIT_CONFIG_VALUE_0=c"}
+	assert.Equal(t, []string{
+		"GIT_CONFIG_KEY_1=http.extraHeader",
+		"GIT_CONFIG_VALUE_1=",
+		"GIT_CONFIG_COUNT=2",
+	}, gitConfigEnv(env, "http.extraHeader", ""))
+	assert.Equal(t, []string{"GIT_CONFIG_COUNT=0"}, gitConfigEnv(nil))
+}
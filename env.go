@@ -1,5 +1,99 @@
 package get
 
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// An Environment configures the environment variables of the version
+// control tools a Downloader runs. The environment is built afresh for
+// each command from the process environment; the Downloader never
+// changes the process environment itself.
+type Environment struct {
+	// AllowPrompts lets the tools prompt for input.
+	//
+	// By default, git is told not to prompt for passwords
+	// (GIT_TERMINAL_PROMPT=0, unless the process environment sets it),
+	// and ssh runs in batch mode. If a tool blocks to ask a question,
+	// such as whether to accept a host key or for a key's passphrase,
+	// the download hangs indefinitely, as nobody is there to answer.
+	// See golang.org/issue/9341 and golang.org/issue/12706.
+	AllowPrompts bool
+
+	// SSHCommand is the command git runs for ssh, as in GIT_SSH_COMMAND.
+	//
+	// By default, unless the process environment sets GIT_SSH or
+	// GIT_SSH_COMMAND, it is ssh with strict host key checking and
+	// connection sharing turned off, and batch mode on unless
+	// AllowPrompts is set. Hosts must be in the user's known_hosts
+	// file; see SSHRule to use another. If a git subprocess
+	// forks a child into the background to cache a new connection, that
+	// child keeps stdout/stderr open, and reading the subprocess's output
+	// doesn't end until the child exits too.
+	// See golang.org/issue/13453 and golang.org/issue/16104.
+	SSHCommand string
+
+	// Extra lists additional variables, as "KEY=value" entries,
+	// which take precedence over the rest of the environment.
+	Extra []string
+
+	// Allow, if non-nil, lists the only variables to inherit from the
+	// process environment. Names ending in "*" are prefixes: "LC_*"
+	// allows every locale variable. The variables the Downloader sets
+	// itself, including Extra, are unaffected.
+	Allow []string
+}
+
+// inherit returns the entries of the process environment env
+// that e allows.
+func (e *Environment) inherit(env []string) []string {
+	if e.Allow == nil {
+		return env
+	}
+	var out []string
+	for _, kv := range env {
+		if matchEnvName(e.Allow, envKey(kv)) {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// defaults returns the variables e sets given the inherited environment env.
+// If askpass is set, prompts are answered through an askpass program,
+// which ssh only uses outside batch mode.
+func (e *Environment) defaults(env []string, askpass bool) []string {
+	var out []string
+	if !e.AllowPrompts && lookupEnv(env, "GIT_TERMINAL_PROMPT") == "" {
+		out = append(out, "GIT_TERMINAL_PROMPT=0")
+	}
+	if e.SSHCommand != "" {
+		out = append(out, "GIT_SSH_COMMAND="+e.SSHCommand)
+	} else if lookupEnv(env, "GIT_SSH") == "" && lookupEnv(env, "GIT_SSH_COMMAND") == "" {
+		ssh := "ssh -o ControlMaster=no -o StrictHostKeyChecking=yes"
+		if !e.AllowPrompts && !askpass {
+			ssh += " -o BatchMode=yes"
+		}
+		out = append(out, "GIT_SSH_COMMAND="+ssh)
+	}
+	return out
+}
+
+// environ returns the environment for running v in dir.
+func (ctx cmdContext) environ(v *vcsCmd, dir string) []string {
+	e := &ctx.environment
+	env := e.inherit(os.Environ())
+	if ctx.hardened {
+		env = append(hardenEnv(env), v.hardenEnv...)
+	}
+	env = append(env, e.defaults(env, ctx.interactive != nil)...)
+	env = append(env, ctx.httpEnv(v)...)
+	env = append(env, e.Extra...)
+	env = append(env, ctx.env...)
+	return envForDir(dir, env)
+}
+
 // envForDir returns a modified environment suitable for running in the given
 // directory.
 // The environment is the supplied base environment but with an updated $PWD, so
@@ -9,3 +103,51 @@ func envForDir(dir string, base []string) []string {
 	// Even if dir is not rooted, no harm done.
 	return append(base, "PWD="+dir)
 }
+
+// gitConfigEnv returns the variables that add the given key, value pairs
+// to git's configuration, after any that env already adds.
+func gitConfigEnv(env []string, keyval ...string) []string {
+	n, _ := strconv.Atoi(lookupEnv(env, "GIT_CONFIG_COUNT"))
+	var out []string
+	for i := 0; i+1 < len(keyval); i += 2 {
+		out = append(out,
+			"GIT_CONFIG_KEY_"+strconv.Itoa(n)+"="+keyval[i],
+			"GIT_CONFIG_VALUE_"+strconv.Itoa(n)+"="+keyval[i+1])
+		n++
+	}
+	return append(out, "GIT_CONFIG_COUNT="+strconv.Itoa(n))
+}
+
+// envKey returns the name of the "KEY=value" entry kv.
+func envKey(kv string) string {
+	if i := strings.Index(kv, "="); i >= 0 {
+		return kv[:i]
+	}
+	return kv
+}
+
+// lookupEnv returns the value of the last entry for key in env,
+// as exec.Cmd would use it.
+func lookupEnv(env []string, key string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if envKey(env[i]) == key {
+			return env[i][len(key)+1:]
+		}
+	}
+	return ""
+}
+
+// matchEnvName reports whether key is one of names,
+// where names ending in "*" are prefixes.
+func matchEnvName(names []string, key string) bool {
+	for _, name := range names {
+		if strings.HasSuffix(name, "*") {
+			if strings.HasPrefix(key, strings.TrimSuffix(name, "*")) {
+				return true
+			}
+		} else if key == name {
+			return true
+		}
+	}
+	return false
+}
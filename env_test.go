@@ -0,0 +1,87 @@
+package get
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvironmentDefaults(t *testing.T) {
+	setenv(t, "GIT_TERMINAL_PROMPT", "")
+	setenv(t, "GIT_SSH", "")
+	setenv(t, "GIT_SSH_COMMAND", "")
+
+	ctx := cmdContext{}
+	env := ctx.environ(vcsGit, "/src")
+	assert.Equal(t, "0", lookupEnv(env, "GIT_TERMINAL_PROMPT"))
+	assert.Equal(t, "ssh -o ControlMaster=no -o StrictHostKeyChecking=yes -o BatchMode=yes", lookupEnv(env, "GIT_SSH_COMMAND"))
+	assert.Equal(t, "/src", lookupEnv(env, "PWD"))
+
+	ctx.environment.AllowPrompts = true
+	env = ctx.environ(vcsGit, "/src")
+	assert.Equal(t, "", lookupEnv(env, "GIT_TERMINAL_PROMPT"))
+	assert.Equal(t, "ssh -o ControlMaster=no -o StrictHostKeyChecking=yes", lookupEnv(env, "GIT_SSH_COMMAND"))
+
+	ctx.environment.SSHCommand = "ssh -i /keys/deploy"
+	env = ctx.environ(vcsGit, "/src")
+	assert.Equal(t, "ssh -i /keys/deploy", lookupEnv(env, "GIT_SSH_COMMAND"))
+}
+
+func TestEnvironmentInherited(t *testing.T) {
+	setenv(t, "GIT_TERMINAL_PROMPT", "1")
+	setenv(t, "GIT_SSH_COMMAND", "my-ssh")
+
+	env := cmdContext{}.environ(vcsGit, "/src")
+	assert.Equal(t, "1", lookupEnv(env, "GIT_TERMINAL_PROMPT"))
+	assert.Equal(t, "my-ssh", lookupEnv(env, "GIT_SSH_COMMAND"))
+
+	setenv(t, "GIT_SSH_COMMAND", "")
+	setenv(t, "GIT_SSH", "/usr/local/bin/my-ssh")
+	env = cmdContext{}.environ(vcsGit, "/src")
+	assert.Equal(t, "", lookupEnv(env, "GIT_SSH_COMMAND"))
+}
+
+func TestEnvironmentAllow(t *testing.T) {
+	setenv(t, "GO_GET_TEST_KEEP", "keep")
+	setenv(t, "GO_GET_TEST_LC_ONE", "one")
+	setenv(t, "GO_GET_TEST_DROP", "drop")
+
+	ctx := cmdContext{environment: Environment{
+		Allow: []string{"GO_GET_TEST_KEEP", "GO_GET_TEST_LC_*"},
+		Extra: []string{"GO_GET_TEST_KEEP=extra", "GO_GET_TEST_DROP=extra"},
+	}}
+	env := ctx.environ(vcsGit, "/src")
+	assert.Equal(t, "extra", lookupEnv(env, "GO_GET_TEST_KEEP"))
+	assert.Equal(t, "one", lookupEnv(env, "GO_GET_TEST_LC_ONE"))
+	assert.Equal(t, "extra", lookupEnv(env, "GO_GET_TEST_DROP"))
+
+	ctx.environment.Extra = nil
+	env = ctx.environ(vcsGit, "/src")
+	assert.Equal(t, "keep", lookupEnv(env, "GO_GET_TEST_KEEP"))
+	assert.NotContains(t, env, "GO_GET_TEST_DROP=drop")
+	assert.NotContains(t, env, "HOME="+os.Getenv("HOME"))
+
+	// The defaults are set even though nothing else is inherited.
+	assert.Equal(t, "0", lookupEnv(env, "GIT_TERMINAL_PROMPT"))
+}
+
+func TestDownloaderLeavesProcessEnv(t *testing.T) {
+	setenv(t, "GIT_TERMINAL_PROMPT", "")
+	setenv(t, "GIT_SSH_COMMAND", "")
+
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	srcRoot := setupDir(t)
+	cloneInto(t, srcRoot, "github.com/tilt-dev/env-test", repo)
+
+	d := NewDownloader(srcRoot)
+	d.Env.Extra = []string{"GO_GET_TEST_EXTRA=1"}
+	_, err := d.Download("github.com/tilt-dev/env-test")
+	require.NoError(t, err)
+
+	assert.Equal(t, "", os.Getenv("GIT_TERMINAL_PROMPT"))
+	assert.Equal(t, "", os.Getenv("GIT_SSH_COMMAND"))
+	_, ok := os.LookupEnv("GO_GET_TEST_EXTRA")
+	assert.False(t, ok)
+}
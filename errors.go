@@ -1,9 +1,14 @@
 package get
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"os/exec"
+	"regexp"
 	"strings"
+
+	"github.com/tilt-dev/go-get/internal/web"
 )
 
 // ImportPathError is a type of error that prevents a package from being loaded
@@ -35,7 +40,7 @@ func ImportErrorf(path, format string, args ...interface{}) ImportPathError {
 }
 
 func (e *importError) Error() string {
-	return e.err.Error()
+	return redact(e.err.Error())
 }
 
 func (e *importError) Unwrap() error {
@@ -47,3 +52,165 @@ func (e *importError) Unwrap() error {
 func (e *importError) ImportPath() string {
 	return e.importPath
 }
+
+// These errors classify why a download failed.
+// Check for them with errors.Is; the error returned is usually an *Error
+// with more detail.
+var (
+	ErrRepoNotFound    = errors.New("repository not found")
+	ErrAuthRequired    = errors.New("authentication required")
+	ErrVCSNotInstalled = errors.New("version control tool not installed")
+	ErrStaleCheckout   = errors.New("stale checkout")
+	ErrRefNotFound     = errors.New("ref not found")
+	ErrUnknownHost     = errors.New("unknown host")
+	ErrDirtyWorkTree   = errors.New("working tree has local changes")
+
+	// ErrChecksumMismatch indicates that installed content doesn't match
+	// the hash recorded for it.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrUnsigned and ErrUntrustedSignature indicate that a checkout
+	// fails the Downloader's signature policy.
+	ErrUnsigned           = errors.New("not signed")
+	ErrUntrustedSignature = errors.New("signature not trusted")
+
+	// ErrPolicyDenied indicates that the Downloader's Policy or GOVCS
+	// setting forbids fetching a repository.
+	ErrPolicyDenied = errors.New("denied by policy")
+
+	// ErrUnsafeCheckout indicates that a checkout has symlinks leading
+	// out of it or exceeds the Downloader's Limits.
+	ErrUnsafeCheckout = errors.New("unsafe checkout")
+)
+
+// An Error describes a failed download step.
+type Error struct {
+	Path string // import path being downloaded, if known
+	Cmd  string // command line that failed, if any
+	Kind error  // one of the Err* values above, or nil if unclassified
+	Err  error  // underlying error
+}
+
+var _ ImportPathError = (*Error)(nil)
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.Path != "" {
+		b.WriteString(e.Path)
+		b.WriteString(": ")
+	}
+	if e.Cmd != "" {
+		b.WriteString(e.Cmd)
+		b.WriteString(": ")
+	}
+	var exitErr *exec.ExitError
+	if errors.As(e.Err, &exitErr) && len(bytes.TrimSpace(exitErr.Stderr)) > 0 {
+		b.WriteString(lastLine(exitErr.Stderr))
+	} else {
+		b.WriteString(e.Err.Error())
+	}
+	return redact(b.String())
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the Err* value e was classified as.
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+func (e *Error) ImportPath() string {
+	return e.Path
+}
+
+// lastLine returns the last non-blank line of out,
+// which for VCS tools is usually the most specific error message.
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// newError returns an *Error for a failure of cmd while downloading
+// importPath, classifying err by its VCS output or HTTP status.
+// If err is already an *Error, newError fills in any missing fields.
+func newError(importPath, cmd string, err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		if e.Path == "" {
+			e.Path = importPath
+		}
+		if e.Cmd == "" {
+			e.Cmd = redact(cmd)
+		}
+		return e
+	}
+	return &Error{Path: importPath, Cmd: redact(cmd), Kind: classify(err), Err: err}
+}
+
+// vcsErrorKinds maps patterns in VCS output, in lower case,
+// to the kind of failure they indicate.
+// Earlier entries take precedence.
+//
+// The patterns are the tools' own phrases for what the server said, not
+// bare words like "not found" or "permission denied": those also come
+// from local failures, such as a missing git-lfs or an unwritable work
+// tree, which no credentials will fix.
+var vcsErrorKinds = []struct {
+	pattern *regexp.Regexp
+	kind    error
+}{
+	{regexp.MustCompile(`did not match any file\(s\) known to git`), ErrRefNotFound},
+	{regexp.MustCompile(`unknown revision`), ErrRefNotFound},
+	{regexp.MustCompile(`couldn't find remote ref`), ErrRefNotFound},
+	{regexp.MustCompile(`invalid reference`), ErrRefNotFound},
+
+	{regexp.MustCompile(`authentication failed`), ErrAuthRequired},
+	{regexp.MustCompile(`authorization failed`), ErrAuthRequired},
+	{regexp.MustCompile(`authorization required`), ErrAuthRequired},
+	{regexp.MustCompile(`could not read username`), ErrAuthRequired},
+	{regexp.MustCompile(`could not read password`), ErrAuthRequired},
+	{regexp.MustCompile(`permission denied \(publickey`), ErrAuthRequired},
+	{regexp.MustCompile(`returned error: 40[13]`), ErrAuthRequired},
+
+	{regexp.MustCompile(`repository not found`), ErrRepoNotFound},
+	{regexp.MustCompile(`repository '[^']*' not found`), ErrRepoNotFound},
+	{regexp.MustCompile(`does not appear to be a git repository`), ErrRepoNotFound},
+	{regexp.MustCompile(`returned error: 404`), ErrRepoNotFound},
+	{regexp.MustCompile(`http error 404`), ErrRepoNotFound},
+
+	{regexp.MustCompile(`could not resolve host`), ErrUnknownHost},
+	{regexp.MustCompile(`name or service not known`), ErrUnknownHost},
+	{regexp.MustCompile(`temporary failure in name resolution`), ErrUnknownHost},
+	{regexp.MustCompile(`no such host`), ErrUnknownHost},
+}
+
+// classify returns the kind of failure err indicates, or nil if unknown.
+func classify(err error) error {
+	if errors.Is(err, exec.ErrNotFound) {
+		return ErrVCSNotInstalled
+	}
+
+	var httpErr *web.HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case 401, 403:
+			return ErrAuthRequired
+		case 404, 410:
+			return ErrRepoNotFound
+		}
+		return nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		out := strings.ToLower(string(exitErr.Stderr))
+		for _, k := range vcsErrorKinds {
+			if k.pattern.MatchString(out) {
+				return k.kind
+			}
+		}
+	}
+	return nil
+}
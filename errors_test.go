@@ -0,0 +1,86 @@
+package get
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tilt-dev/go-get/internal/web"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind error
+	}{
+		{exitError("remote: Repository not found.\nfatal: repository 'https://github.com/a/b/' not found\n"), ErrRepoNotFound},
+		{exitError("fatal: could not read Username for 'https://github.com': terminal prompts disabled\n"), ErrAuthRequired},
+		{exitError("git@github.com: Permission denied (publickey).\n"), ErrAuthRequired},
+		{exitError("error: pathspec 'v9' did not match any file(s) known to git\n"), ErrRefNotFound},
+		{exitError("abort: unknown revision 'v9'!\n"), ErrRefNotFound},
+		{exitError("fatal: unable to access 'https://x.invalid/': Could not resolve host: x.invalid\n"), ErrUnknownHost},
+		{exitError("abort: HTTP Error 404: Not Found\n"), ErrRepoNotFound},
+		{exitError("fatal: Authentication failed for 'https://example.com/a/b/'\n"), ErrAuthRequired},
+		{exitError("fatal: early EOF\n"), nil},
+
+		// Local failures that share words with the server's answers.
+		{exitError("sh: git-lfs: command not found\n"), nil},
+		{exitError("error: could not lock config file .git/config: Permission denied\n"), nil},
+		{exitError("fatal: Unable to create '/src/x/.git/index.lock': Permission denied\n"), nil},
+		{exitError("mkdir: cannot create directory 'vendor': Permission denied\n"), nil},
+		{exitError("error: unable to read askpass response: file not found\n"), nil},
+		{&web.HTTPError{StatusCode: 403}, ErrAuthRequired},
+		{&web.HTTPError{StatusCode: 404}, ErrRepoNotFound},
+		{&web.HTTPError{StatusCode: 500}, nil},
+	}
+	for _, test := range tests {
+		if got := classify(test.err); got != test.kind {
+			t.Errorf("classify(%v) = %v, want %v", test.err, got, test.kind)
+		}
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	repo := gitRepo(t, map[string]string{"Tiltfile": `print("Hello world!")`})
+	dir := setupDir(t)
+	ctx := newCmdContext(".", nil)
+	ctx.importPath = "example.com/repo.git"
+
+	err := vcsGit.create(ctx, filepath.Join(dir, "missing"), "file://"+filepath.Join(dir, "no-such-repo"))
+	assert.True(t, errors.Is(err, ErrRepoNotFound), "got %v", err)
+
+	dest := filepath.Join(dir, "repo")
+	require.NoError(t, vcsGit.create(ctx, dest, "file://"+repo))
+	err = vcsGit.tagSync(ctx, dest, "no-such-tag")
+	assert.True(t, errors.Is(err, ErrRefNotFound), "got %v", err)
+
+	err = vcsGit.run(ctx.withDir(dest), "checkout {tag}", "tag", "no-such-tag")
+	assert.True(t, errors.Is(err, ErrRefNotFound), "got %v", err)
+
+	var e *Error
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, "example.com/repo.git", e.ImportPath())
+		assert.Equal(t, "git checkout no-such-tag", e.Cmd)
+		assert.Contains(t, e.Error(), "example.com/repo.git: git checkout no-such-tag: error: pathspec 'no-such-tag'")
+	}
+
+	missing := &vcsCmd{name: "Missing", cmd: "no-such-vcs-tool"}
+	err = missing.run(ctx.withDir(dir), "status")
+	assert.True(t, errors.Is(err, ErrVCSNotInstalled), "got %v", err)
+}
+
+func TestStaleCheckout(t *testing.T) {
+	dir := setupDir(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "github.com", "tilt-dev", "tilt-extensions"), 0755))
+	_, err := NewDownloader(dir).Download("github.com/tilt-dev/tilt-extensions/hello_world")
+	assert.True(t, errors.Is(err, ErrStaleCheckout), "got %v", err)
+
+	var pathErr ImportPathError
+	if assert.True(t, errors.As(err, &pathErr)) {
+		assert.Equal(t, "github.com/tilt-dev/tilt-extensions/hello_world", pathErr.ImportPath())
+	}
+}
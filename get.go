@@ -10,62 +10,139 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/tilt-dev/go-get/internal/sumdb"
 	"github.com/tilt-dev/go-get/internal/web"
 )
 
-func init() {
-	// Disable any prompting for passwords by Git.
-	// Only has an effect for 2.3.0 or later, but avoiding
-	// the prompt in earlier versions is just too hard.
-	// If user has explicitly set GIT_TERMINAL_PROMPT=1, keep
-	// prompting.
-	// See golang.org/issue/9341 and golang.org/issue/12706.
-	if os.Getenv("GIT_TERMINAL_PROMPT") == "" {
-		os.Setenv("GIT_TERMINAL_PROMPT", "0")
-	}
-
-	// ISSUE 1
-	// Disable any ssh connection pooling by Git.
-	// If a Git subprocess forks a child into the background to cache a new connection,
-	// that child keeps stdout/stderr open. After the Git subprocess exits,
-	// os /exec expects to be able to read from the stdout/stderr pipe
-	// until EOF to get all the data that the Git subprocess wrote before exiting.
-	// The EOF doesn't come until the child exits too, because the child
-	// is holding the write end of the pipe.
-	// This is unfortunate, but it has come up at least twice
-	// (see golang.org/issue/13453 and golang.org/issue/16104)
-	// and confuses users when it does.
-	//
-	// ISSUE 2
-	// Do not attempt to prompt the user.
-	// If a Git subprocess blocks for user interaction for a question (e.g.
-	// accept host key, provide SSH keyfile passphrase), the download can hang
-	// indefinitely, as the prompt.
-	// Arguably, this should be configurable on the Downloader instance, but
-	// it suits our needs to _always_ run in non-interactive mode, so it's
-	// always applied, as this package isn't particularly amenable to making
-	// it conditional.
-	//
-	// If the user has explicitly set GIT_SSH or GIT_SSH_COMMAND,
-	// assume they know what they are doing and don't step on it.
-	// But default to turning off ControlMaster and turning on BatchMode.
-	if os.Getenv("GIT_SSH") == "" && os.Getenv("GIT_SSH_COMMAND") == "" {
-		os.Setenv("GIT_SSH_COMMAND", "ssh -o ControlMaster=no -o BatchMode=yes")
-	}
-}
-
 // Downloader fetches repositories under the given source tree.
 // Not thread-safe.
 type Downloader struct {
+	// Logger, if non-nil, receives the Downloader's diagnostics:
+	// every command run at LevelDebug, and failures at LevelError.
+	Logger Logger
+
+	// Stderr, if non-nil and Logger is nil, receives records at LevelInfo
+	// and above, formatted as by NewTextLogger.
+	//
+	// Deprecated: Use Logger.
 	Stderr io.Writer
 
+	// Observer, if non-nil, receives an Event for each step of a download,
+	// including transfer progress parsed from the VCS.
+	Observer Observer
+
+	// Retry, if non-nil, retries clones, fetches, scheme probes and
+	// discovery requests that fail with transient network errors.
+	Retry *RetryPolicy
+
+	// DirtyPolicy says what to do when Download or RefSync would update
+	// a checkout with uncommitted local changes. Defaults to DirtyAllow.
+	DirtyPolicy DirtyPolicy
+
+	// SumDB, if non-nil, is the checksum database that RefSync checks
+	// each semantic version tag against. See VerifySum.
+	SumDB *SumDB
+
+	// Signatures lists the repositories whose checkouts must be signed.
+	// The first rule matching a repository root applies to it.
+	//
+	// When an update of an existing checkout fails the signature rule,
+	// the checksum database or the checkout scan, the revision it had
+	// before is checked out again. A new clone that fails is left in
+	// place. Either way, the rejected ref isn't recorded for WriteLock.
+	Signatures []SignatureRule
+
+	// Policy, if non-nil, restricts which repositories may be fetched.
+	Policy *Policy
+
+	// GOVCS restricts which version control tools may be run for which
+	// repositories, in the syntax of the go command's GOVCS variable:
+	// "public:git|hg,private:all", "*.corp.example.com:git" or "off".
+	// As for the go command, the rules public:git|hg and private:all
+	// follow the ones given, so that by default only Git and Mercurial
+	// are used for public repositories. Defaults to $GOVCS.
+	//
+	// This default is a change: a Downloader used to allow every tool
+	// when neither GOVCS nor $GOVCS was set. Public Bazaar, Fossil and
+	// Subversion repositories now need a rule such as "public:all", or
+	// their paths listed in Private.
+	GOVCS string
+
+	// Private is a comma-separated list of glob patterns, in the syntax
+	// of GOPRIVATE, matching the import path prefixes of private
+	// repositories for GOVCS. Defaults to $GOPRIVATE.
+	Private string
+
+	// Hardened runs version control tools as if the repositories they
+	// touch were hostile. A repository's configuration can name programs
+	// to run, such as git's core.fsmonitor and hooks or Mercurial's hooks,
+	// and its submodules or externals can point at local files or commands.
+	// In hardened mode, every command line overrides those settings:
+	// git runs without fsmonitor or hooks and refuses the file and ext
+	// transports, Mercurial ignores the repository's hgrc and hooks,
+	// Subversion skips externals and never prompts, and Bazaar loads no
+	// plugins. Variables such as GIT_DIR, GIT_WORK_TREE and GIT_CONFIG_*
+	// are also dropped from the environment, so that the caller's
+	// environment can't redirect git to another repository or config.
+	Hardened bool
+
+	// Limits, if non-nil, bounds the size of every checkout. Checkouts
+	// are scanned after every update, whether or not there are limits:
+	// symlinks must resolve to somewhere inside the checkout, and the tree
+	// must stay within the limits. A checkout that fails is rolled back as
+	// for Signatures, and the update fails with a *CheckoutError.
+	Limits *CheckoutLimits
+
+	// Env configures the environment of the version control tools.
+	// By default they inherit the process environment and never prompt.
+	Env Environment
+
+	// Interactive, if non-nil, lets git and ssh prompt for credentials
+	// and passphrases, answered by the caller. See Interactive.
+	Interactive *Interactive
+
+	// Credentials, if non-nil, supplies the credentials for HTTPS
+	// requests and HTTPS git repositories. If nil, HTTPS requests use
+	// $GOAUTH, which defaults to the user's .netrc file without its
+	// default entry, and git finds its own credentials. Problems with the
+	// .netrc file are then logged at LevelWarn.
+	Credentials CredentialProvider
+
+	// SSH lists the ssh options for repositories reached over ssh,
+	// such as the key to authenticate with. The first rule matching
+	// a repository applies to it.
+	SSH []SSHRule
+
+	// HTTP, if non-nil, configures the HTTP connections of discovery and
+	// API requests, and what of it applies to the version control tools.
+	// See HTTPConfig.
+	HTTP *HTTPConfig
+
+	// HTTPCacheDir holds the responses to discovery and API requests
+	// made without credentials, which are reused as their Cache-Control
+	// headers allow, and for up to a week when the network is down.
+	// Defaults to .go-get-cache/http in the source root; "off" disables
+	// the cache.
+	HTTPCacheDir string
+
+	// RepoRootTTL is how long the repository found for an import path,
+	// including the scheme found by probing the repository, is reused
+	// before the path is resolved again. Resolutions are kept in memory
+	// and in .go-get-cache/reporoot in the source root, and dropped when
+	// a clone or fetch from the repository fails. Defaults to 24 hours;
+	// a negative TTL disables the cache.
+	RepoRootTTL time.Duration
+
 	srcRoot string
+	roots   map[string]repoRootEntry // import path -> cached repository root
+	sumdb   *sumdb.Client            // created on first use from SumDB
+	goAuth  *GoAuthCredentials       // created on first use, when Credentials is nil
 }
 
 func NewDownloader(srcRoot string) *Downloader {
 	return &Downloader{
-		Stderr:  os.Stderr,
 		srcRoot: srcRoot,
 	}
 }
@@ -73,6 +150,19 @@ func NewDownloader(srcRoot string) *Downloader {
 // Analyze the import path to determine the version control system,
 // repository, and the import path for the root of the repository.
 func (d *Downloader) repoRoot(pkg string) (string, *repoRoot, error) {
+	ctx := d.toCmdContext(pkg, ".")
+	ctx.emit(Event{Kind: EventResolveStart})
+	start := time.Now()
+	pkg, rr, err := d.resolve(ctx, pkg)
+	done := Event{Kind: EventResolveDone, Duration: time.Since(start), Err: err}
+	if rr != nil {
+		done.VCS, done.Repo = rr.VCS, rr.Repo
+	}
+	ctx.emit(done)
+	return pkg, rr, err
+}
+
+func (d *Downloader) resolve(ctx cmdContext, pkg string) (string, *repoRoot, error) {
 	security := web.SecureOnly
 	if i := strings.Index(pkg, "..."); i >= 0 {
 		slash := strings.LastIndexByte(pkg[:i], '/')
@@ -85,36 +175,88 @@ func (d *Downloader) repoRoot(pkg string) (string, *repoRoot, error) {
 		return "", nil, fmt.Errorf("%s: invalid import path: %v", pkg, err)
 	}
 
-	rr, err := repoRootForImportPath(pkg, security, d.Stderr)
-	if err != nil {
+	if err := d.Policy.checkImportPath(pkg); err != nil {
 		return "", nil, err
 	}
-	return pkg, rr, err
+
+	rr := d.cachedRepoRoot(pkg, security)
+	cached := rr != nil
+	if cached {
+		if err := checkGOVCS(ctx, rr.vcs, rr.Root); err != nil {
+			return "", nil, err
+		}
+		ctx.log(LevelDebug, "using cached repository", "path", pkg, "vcs", rr.VCS, "repo", rr.Repo)
+	} else {
+		var err error
+		rr, err = repoRootForImportPath(ctx, pkg, security)
+		if err == errUnknownSite {
+			return "", nil, &Error{Path: pkg, Kind: ErrUnknownHost, Err: err}
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	if err := d.Policy.checkRepo(pkg, rr.vcs.cmd, rr.Repo); err != nil {
+		return "", nil, err
+	}
+	if !cached {
+		if err := d.saveRepoRoot(pkg, rr); err != nil {
+			ctx.log(LevelDebug, "caching repository failed", "path", pkg, "err", err)
+		}
+	}
+	return pkg, rr, nil
 }
 
 // Download runs the create or download command to make the first copy of or
 // update a copy of the given package.
 func (d *Downloader) Download(pkg string) (string, error) {
+	res, err := d.DownloadWithResult(pkg)
+	if err != nil {
+		return "", err
+	}
+	return res.Path, nil
+}
+
+// DownloadWithResult is like Download, but also reports
+// the signature verified for the checkout.
+func (d *Downloader) DownloadWithResult(pkg string) (_ *DownloadResult, err error) {
+	defer wrapError(pkg, &err)
+
 	var (
 		vcs            *vcsCmd
 		repo, rootPath string
-		err            error
 	)
 
 	srcRoot := d.srcRoot
 	pkg, rr, err := d.repoRoot(pkg)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	vcs, repo, rootPath = rr.vcs, rr.Repo, rr.Root
 
 	result := filepath.Join(srcRoot, filepath.FromSlash(pkg))
 	root := filepath.Join(srcRoot, filepath.FromSlash(rootPath))
+	ctx := d.toCmdContext(pkg, ".").withRepo(repo)
 
 	if err := checkNestedVCS(vcs, root, srcRoot); err != nil {
-		return "", err
+		return nil, err
 	}
 
+	// Re-apply any local changes that the DirtyPolicy set aside,
+	// once the update has finished.
+	var (
+		restore func() error
+		prev    *checkoutState // what an existing checkout had before
+	)
+	defer func() {
+		if restore == nil {
+			return
+		}
+		if rerr := restore(); err == nil {
+			err = rerr
+		}
+	}()
+
 	// Check that this is an appropriate place for the repo to be checked out.
 	// The target directory must either not exist or have a repo checked out already.
 	meta := filepath.Join(root, "."+vcs.cmd)
@@ -123,50 +265,203 @@ func (d *Downloader) Download(pkg string) (string, error) {
 		// Some version control tools require the target directory not to exist.
 		// We require that too, just to avoid stepping on existing work.
 		if _, err := os.Stat(root); err == nil {
-			return "", fmt.Errorf("%s exists but %s does not - stale checkout?", root, meta)
+			return nil, &Error{Kind: ErrStaleCheckout, Err: fmt.Errorf("%s exists but %s does not - stale checkout?", root, meta)}
 		}
 
 		// Some version control tools require the parent of the target to exist.
 		parent, _ := filepath.Split(root)
 		if err = os.MkdirAll(parent, 0777); err != nil {
-			return "", err
+			return nil, err
 		}
 
-		if err = vcs.create(root, repo, d.Stderr); err != nil {
-			return "", err
+		done := ctx.step(Event{Kind: EventCloneStart, VCS: vcs.cmd, Repo: repo, Dir: root}, EventCloneDone)
+		first := true
+		err = ctx.retry("clone", func() error {
+			if !first {
+				// Clear out whatever the failed attempt left behind,
+				// since create requires that root not exist.
+				if err := os.RemoveAll(root); err != nil {
+					return err
+				}
+			}
+			first = false
+			return vcs.create(ctx, root, repo)
+		})
+		done(err)
+		if err != nil {
+			d.forgetRepoRoot(pkg)
+			return nil, err
 		}
 	} else {
 		// Metadata directory does exist; download incremental updates.
-		if err = vcs.download(root, d.Stderr); err != nil {
-			return "", err
+		restore, err = d.prepareUpdate(ctx, vcs, root)
+		if err != nil {
+			return nil, err
+		}
+		prev = saveCheckout(ctx, vcs, root)
+
+		done := ctx.step(Event{Kind: EventFetchStart, VCS: vcs.cmd, Repo: repo, Dir: root}, EventFetchDone)
+		err = ctx.retry("fetch", func() error { return vcs.download(ctx, root) })
+		done(err)
+		if err != nil {
+			d.forgetRepoRoot(pkg)
+			return nil, err
 		}
 	}
 
 	// Select and sync to appropriate version of the repository.
-	if err := vcs.tagSync(root, "", d.Stderr); err != nil {
-		return "", err
+	done := ctx.step(Event{Kind: EventCheckoutStart, VCS: vcs.cmd, Repo: repo, Dir: root}, EventCheckoutDone)
+	err = vcs.tagSync(ctx, root, "")
+	done(err)
+	if err != nil {
+		return nil, err
 	}
 
-	return result, nil
+	sig, err := d.verifyCheckout(ctx, vcs, pkg, rootPath, root, "")
+	if err != nil {
+		prev.rollback(ctx, vcs, root)
+		return nil, err
+	}
+	d.clearQuery(rootPath)
+	return &DownloadResult{Path: result, Signature: sig}, nil
 }
 
 // Update the checked out repo to the given ref.
 // Assumes the repo has already been downloaded.
 func (d *Downloader) RefSync(pkg, tag string) error {
+	_, err := d.RefSyncWithResult(pkg, tag)
+	return err
+}
+
+// RefSyncWithResult is like RefSync, but also reports
+// the signature verified for the checkout.
+func (d *Downloader) RefSyncWithResult(pkg, tag string) (_ *DownloadResult, err error) {
+	defer wrapError(pkg, &err)
+
 	srcRoot := d.srcRoot
 	_, rr, err := d.repoRoot(pkg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	vcs, rootPath := rr.vcs, rr.Root
 	root := filepath.Join(srcRoot, filepath.FromSlash(rootPath))
-	cmdCtx := newCmdContext(root, d.Stderr)
+	cmdCtx := d.toCmdContext(pkg, root).withRepo(rr.Repo)
+	restore, err := d.prepareUpdate(cmdCtx, vcs, root)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rerr := restore(); err == nil {
+			err = rerr
+		}
+	}()
+
+	prev := saveCheckout(cmdCtx, vcs, root)
+	done := cmdCtx.step(Event{Kind: EventCheckoutStart, VCS: vcs.cmd, Repo: rr.Repo, Dir: root, Ref: tag}, EventCheckoutDone)
 	for _, cmd := range vcs.tagSyncCmd {
 		if err := vcs.run(cmdCtx, cmd, "tag", tag); err != nil {
-			return err
+			done(err)
+			return nil, err
 		}
 	}
-	return nil
+	done(nil)
+
+	sig, err := d.verifyCheckout(cmdCtx, vcs, pkg, rootPath, root, tag)
+	if err != nil {
+		prev.rollback(cmdCtx, vcs, root)
+		return nil, err
+	}
+	rev, _ := vcs.revision(cmdCtx, root)
+	d.setQuery(cmdCtx, rootPath, tag, rev)
+	return &DownloadResult{Path: d.DestinationPath(pkg), Signature: sig}, nil
+}
+
+// verifyCheckout runs the checks on the checkout of pkg in root after
+// it is synced to ref: the checkout scan, the signature rule, and the
+// checksum database for semantic versions.
+func (d *Downloader) verifyCheckout(ctx cmdContext, vcs *vcsCmd, pkg, rootPath, root, ref string) (*SignatureResult, error) {
+	if err := d.scanCheckout(pkg, root); err != nil {
+		return nil, err
+	}
+	sig, err := d.verifySignature(ctx, vcs, rootPath, root, ref)
+	if err != nil {
+		return nil, err
+	}
+	if d.SumDB != nil && semverRe.MatchString(ref) {
+		if err := d.VerifySum(pkg, ref); err != nil {
+			return nil, err
+		}
+	}
+	return sig, nil
+}
+
+// A checkoutState is what a checkout had checked out before an update,
+// so that an update that fails its checks can be undone.
+type checkoutState struct {
+	rev    string
+	branch string // the branch that was checked out, if any
+}
+
+// saveCheckout returns the state of the checkout in dir,
+// or nil if vcs can't return to it.
+func saveCheckout(ctx cmdContext, vcs *vcsCmd, dir string) *checkoutState {
+	if vcs.revisionCmd == "" || vcs.tagSyncCmd == nil {
+		return nil
+	}
+	rev, err := vcs.revision(ctx, dir)
+	if err != nil || rev == "" {
+		return nil
+	}
+	s := &checkoutState{rev: rev}
+	if vcs.branchCmd != "" {
+		// The command fails when no branch is checked out.
+		if out, err := vcs.run1(ctx.withDir(dir), vcs.branchCmd, nil, false); err == nil {
+			s.branch = strings.TrimSpace(string(out))
+		}
+	}
+	return s
+}
+
+// rollback checks out s again in dir, after an update that failed its
+// checks, so that the rejected code isn't left in place. A nil s,
+// for a new clone, does nothing.
+func (s *checkoutState) rollback(ctx cmdContext, vcs *vcsCmd, dir string) {
+	if s == nil {
+		return
+	}
+	cmdCtx := ctx.withDir(dir)
+	var err error
+	if s.branch != "" {
+		for _, cmd := range vcs.rollbackCmd {
+			if err = vcs.run(cmdCtx, cmd, "branch", s.branch, "rev", s.rev); err != nil {
+				break
+			}
+		}
+	} else {
+		for _, cmd := range vcs.tagSyncCmd {
+			if err = vcs.run(cmdCtx, cmd, "tag", s.rev); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		ctx.log(LevelError, "restoring the previous checkout failed", "dir", dir, "rev", s.rev, "err", err)
+		return
+	}
+	ctx.log(LevelWarn, "restored the previous checkout", "dir", dir, "rev", s.rev)
+}
+
+// Status reports the local changes in the checkout of the given package.
+// Assumes the repo has already been downloaded.
+func (d *Downloader) Status(pkg string) (_ *Status, err error) {
+	defer wrapError(pkg, &err)
+
+	_, rr, err := d.repoRoot(pkg)
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Join(d.srcRoot, filepath.FromSlash(rr.Root))
+	return rr.vcs.status(d.toCmdContext(pkg, root), root)
 }
 
 // Determines where the repository will be downloaded before we download it.
@@ -178,25 +473,74 @@ func (d *Downloader) DestinationPath(pkg string) string {
 // Determines the hash of the currently checked out head.
 //
 // Returns the empty string if the current VCS does not support HEAD references.
-func (d *Downloader) HeadRef(pkg string) (string, error) {
+func (d *Downloader) HeadRef(pkg string) (_ string, err error) {
+	defer wrapError(pkg, &err)
+
 	srcRoot := d.srcRoot
 	_, rr, err := d.repoRoot(pkg)
 	if err != nil {
 		return "", err
 	}
 	vcs := rr.vcs
-	if vcs == nil || vcs.cmd != "git" {
+	if vcs == nil || vcs.revisionCmd == "" {
 		return "", nil
 	}
 	rootPath := rr.Root
 	root := filepath.Join(srcRoot, filepath.FromSlash(rootPath))
-	out, err := vcs.runOutput(d.toCmdContext(root), "rev-parse HEAD")
-	if err != nil {
-		return "", err
+	return vcs.revision(d.toCmdContext(pkg, root), root)
+}
+
+// wrapError converts a non-nil *errp into an *Error for pkg,
+// so that callers can always find the import path and kind of failure.
+// Errors that already report an import path are left alone.
+func wrapError(pkg string, errp *error) {
+	if *errp == nil {
+		return
+	}
+	if ipe, ok := (*errp).(ImportPathError); ok && ipe.ImportPath() != "" {
+		return
+	}
+	*errp = newError(pkg, "", *errp)
+}
+
+func (d *Downloader) toCmdContext(pkg, dir string) cmdContext {
+	return cmdContext{
+		logger:      d.logger(),
+		dir:         dir,
+		importPath:  pkg,
+		observer:    d.Observer,
+		retryPolicy: d.Retry,
+		govcs:       d.GOVCS,
+		private:     d.Private,
+		hardened:    d.Hardened,
+		environment: d.Env,
+		interactive: d.Interactive,
+		credentials: d.Credentials,
+		goAuth:      d.defaultCredentials(),
+		ssh:         d.SSH,
+		policy:      d.Policy,
+		http:        d.HTTP,
+		httpCache:   d.httpCacheDir(),
+	}
+}
+
+// httpCacheDir returns the directory of the HTTP cache, or "" if it is off.
+func (d *Downloader) httpCacheDir() string {
+	switch d.HTTPCacheDir {
+	case "off":
+		return ""
+	case "":
+		return filepath.Join(d.srcRoot, ".go-get-cache", "http")
 	}
-	return strings.TrimSpace(string(out)), nil
+	return d.HTTPCacheDir
 }
 
-func (d *Downloader) toCmdContext(dir string) cmdContext {
-	return cmdContext{stderr: d.Stderr, dir: dir}
+func (d *Downloader) logger() Logger {
+	if d.Logger != nil {
+		return d.Logger
+	}
+	if d.Stderr != nil {
+		return NewTextLogger(d.Stderr, LevelInfo)
+	}
+	return nil
 }
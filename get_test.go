@@ -3,7 +3,11 @@ package get
 import (
 	"errors"
 	"io/ioutil"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -15,7 +19,7 @@ import (
 
 func tmpdir(t *testing.T) string {
 	t.Helper()
-	dir, err := ioutil.TempDir("", t.Name())
+	dir, err := ioutil.TempDir("", strings.ReplaceAll(t.Name(), "/", "_"))
 	require.NoError(t, err, "Could not create tmpdir")
 	t.Cleanup(func() {
 		_ = os.RemoveAll(dir)
@@ -23,6 +27,20 @@ func tmpdir(t *testing.T) string {
 	return dir
 }
 
+// setenv sets an environment variable for the rest of the test.
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+	old, had := os.LookupEnv(key)
+	require.NoError(t, os.Setenv(key, value))
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
 func setupDir(t *testing.T) string {
 	t.Helper()
 
@@ -184,3 +202,85 @@ func TestGetCached(t *testing.T) {
 	require.NoError(t, err)
 	assert.Contains(t, string(tiltfile), `print("Goodbye world!")`)
 }
+
+// gitRepo creates a local git repository with a single commit
+// containing the given files, and returns its path.
+func gitRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := tmpdir(t)
+	runGit(t, dir, "init", "-q")
+	gitCommit(t, dir, files)
+	return dir
+}
+
+// gitCommit writes the given files to the repository in dir and commits them.
+func gitCommit(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", "commit")
+}
+
+// runGit runs git in dir and returns its trimmed output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, "git %s: %s", strings.Join(args, " "), out)
+	return strings.TrimSpace(string(out))
+}
+
+// cloneInto clones the local repository repo to where a Downloader
+// rooted at srcRoot expects the repository for importPath, so that
+// tests can exercise updates without network access.
+func cloneInto(t *testing.T, srcRoot, importPath, repo string) string {
+	t.Helper()
+	dest := filepath.Join(srcRoot, filepath.FromSlash(importPath))
+	require.NoError(t, os.MkdirAll(filepath.Dir(dest), 0755))
+	runGit(t, srcRoot, "clone", "-q", repo, dest)
+	return dest
+}
+
+// gitHTTPServer serves the local repository repo over git's smart HTTP
+// protocol, returning its URL. Requests that auth rejects get a 401
+// challenge for basic authentication.
+func gitHTTPServer(t *testing.T, repo string, auth func(r *http.Request) bool) string {
+	t.Helper()
+	srv := httptest.NewServer(gitHandler(t, repo, auth))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/" + filepath.Base(repo)
+}
+
+// gitHTTPSServer is like gitHTTPServer, but serves HTTPS
+// with a certificate git doesn't trust.
+func gitHTTPSServer(t *testing.T, repo string, auth func(r *http.Request) bool) string {
+	t.Helper()
+	srv := httptest.NewTLSServer(gitHandler(t, repo, auth))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/" + filepath.Base(repo)
+}
+
+func gitHandler(t *testing.T, repo string, auth func(r *http.Request) bool) http.Handler {
+	t.Helper()
+	execPath := runGit(t, repo, "--exec-path")
+	backend := &cgi.Handler{
+		Path: filepath.Join(execPath, "git-http-backend"),
+		Env:  []string{"GIT_PROJECT_ROOT=" + filepath.Dir(repo), "GIT_HTTP_EXPORT_ALL=1"},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth != nil && !auth(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	})
+}
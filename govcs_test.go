@@ -0,0 +1,184 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package get
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tilt-dev/go-get/internal/web"
+)
+
+var govcsTests = []struct {
+	govcs string
+	path  string
+	vcs   string
+	ok    bool
+}{
+	{"private:all", "is-public.com/foo", "zzz", false},
+	{"private:all", "is-private.com/foo", "zzz", true},
+	{"public:all", "is-public.com/foo", "zzz", true},
+	{"public:all", "is-private.com/foo", "zzz", false},
+	{"public:all,private:none", "is-public.com/foo", "zzz", true},
+	{"public:all,private:none", "is-private.com/foo", "zzz", false},
+	{"*:all", "is-public.com/foo", "zzz", true},
+	{"golang.org:git", "golang.org/x/text", "zzz", false},
+	{"golang.org:git", "golang.org/x/text", "git", true},
+	{"golang.org:zzz", "golang.org/x/text", "zzz", true},
+	{"golang.org:zzz", "golang.org/x/text", "git", false},
+	{"golang.org:zzz", "golang.org/x/text", "zzz", true},
+	{"golang.org:zzz", "golang.org/x/text", "git", false},
+	{"golang.org:git|hg", "golang.org/x/text", "hg", true},
+	{"golang.org:git|hg", "golang.org/x/text", "git", true},
+	{"golang.org:git|hg", "golang.org/x/text", "zzz", false},
+	{"golang.org:all", "golang.org/x/text", "hg", true},
+	{"golang.org:all", "golang.org/x/text", "git", true},
+	{"golang.org:all", "golang.org/x/text", "zzz", true},
+	{"other.xyz/p:none,golang.org/x:git", "other.xyz/p/x", "git", false},
+	{"other.xyz/p:none,golang.org/x:git", "unexpected.com", "git", false},
+	{"other.xyz/p:none,golang.org/x:git", "golang.org/x/text", "zzz", false},
+	{"other.xyz/p:none,golang.org/x:git", "golang.org/x/text", "git", true},
+	{"other.xyz/p:none,golang.org/x:zzz", "golang.org/x/text", "zzz", true},
+	{"other.xyz/p:none,golang.org/x:zzz", "golang.org/x/text", "git", false},
+	{"other.xyz/p:none,golang.org/x:git|hg", "golang.org/x/text", "hg", true},
+	{"other.xyz/p:none,golang.org/x:git|hg", "golang.org/x/text", "git", true},
+	{"other.xyz/p:none,golang.org/x:git|hg", "golang.org/x/text", "zzz", false},
+	{"other.xyz/p:none,golang.org/x:all", "golang.org/x/text", "hg", true},
+	{"other.xyz/p:none,golang.org/x:all", "golang.org/x/text", "git", true},
+	{"other.xyz/p:none,golang.org/x:all", "golang.org/x/text", "zzz", true},
+	{"other.xyz/p:none,golang.org/x:git", "golang.org/y/text", "zzz", false},
+	{"other.xyz/p:none,golang.org/x:git", "golang.org/y/text", "git", false},
+	{"other.xyz/p:none,golang.org/x:zzz", "golang.org/y/text", "zzz", false},
+	{"other.xyz/p:none,golang.org/x:zzz", "golang.org/y/text", "git", false},
+	{"other.xyz/p:none,golang.org/x:git|hg", "golang.org/y/text", "hg", false},
+	{"other.xyz/p:none,golang.org/x:git|hg", "golang.org/y/text", "git", false},
+	{"other.xyz/p:none,golang.org/x:git|hg", "golang.org/y/text", "zzz", false},
+	{"other.xyz/p:none,golang.org/x:all", "golang.org/y/text", "hg", false},
+	{"other.xyz/p:none,golang.org/x:all", "golang.org/y/text", "git", false},
+	{"other.xyz/p:none,golang.org/x:all", "golang.org/y/text", "zzz", false},
+}
+
+func TestGOVCS(t *testing.T) {
+	for _, tt := range govcsTests {
+		cfg, err := parseGOVCS(tt.govcs)
+		if err != nil {
+			t.Errorf("parseGOVCS(%q): %v", tt.govcs, err)
+			continue
+		}
+		private := strings.HasPrefix(tt.path, "is-private")
+		ok := cfg.allow(tt.path, private, tt.vcs)
+		if ok != tt.ok {
+			t.Errorf("parseGOVCS(%q).allow(%q, %v, %q) = %v, want %v",
+				tt.govcs, tt.path, private, tt.vcs, ok, tt.ok)
+		}
+	}
+}
+
+var govcsErrors = []struct {
+	s   string
+	err string
+}{
+	{`,`, `empty entry in GOVCS`},
+	{`,x`, `empty entry in GOVCS`},
+	{`x,`, `malformed entry in GOVCS (missing colon): "x"`},
+	{`x:y,`, `empty entry in GOVCS`},
+	{`x`, `malformed entry in GOVCS (missing colon): "x"`},
+	{`x:`, `empty VCS list in GOVCS: "x:"`},
+	{`x:|`, `empty VCS name in GOVCS: "x:|"`},
+	{`x:y|`, `empty VCS name in GOVCS: "x:y|"`},
+	{`x:|y`, `empty VCS name in GOVCS: "x:|y"`},
+	{`x:y,z:`, `empty VCS list in GOVCS: "z:"`},
+	{`x:y,z:|`, `empty VCS name in GOVCS: "z:|"`},
+	{`x:y,z:|w`, `empty VCS name in GOVCS: "z:|w"`},
+	{`x:y,z:w|`, `empty VCS name in GOVCS: "z:w|"`},
+	{`x:y,z:w||v`, `empty VCS name in GOVCS: "z:w||v"`},
+	{`x:y,x:z`, `unreachable pattern in GOVCS: "x:z" after "x:y"`},
+}
+
+func TestGOVCSErrors(t *testing.T) {
+	for _, tt := range govcsErrors {
+		_, err := parseGOVCS(tt.s)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("parseGOVCS(%s): err=%v, want %v", tt.s, err, tt.err)
+		}
+	}
+}
+
+func TestGOVCSOff(t *testing.T) {
+	cfg, err := parseGOVCS("off")
+	require.NoError(t, err)
+	cfg = append(cfg, defaultGOVCS...)
+	assert.False(t, cfg.allow("github.com/tilt-dev/ext", false, "git"))
+	assert.False(t, cfg.allow("go.corp.example.com/ext", true, "git"))
+}
+
+func TestDownloaderGOVCS(t *testing.T) {
+	setenv(t, "GOVCS", "")
+
+	// chiselapp.com repositories use fossil, which the default rules
+	// only allow for private repositories.
+	const pkg = "chiselapp.com/user/tilt/repository/govcs-test"
+	ctx := newCmdContext(".", nil)
+	ctx.govcs = "*.corp.example.com:git"
+	ctx.private = "github.com/tilt-dev"
+	_, err := repoRootForImportPath(ctx, pkg, web.SecureOnly)
+	assert.True(t, errors.Is(err, ErrPolicyDenied), "%v", err)
+	assert.Contains(t, err.Error(), "GOVCS disallows using fossil for public chiselapp.com/user/tilt/repository/govcs-test")
+
+	ctx.private = "chiselapp.com/user/tilt"
+	rr, err := repoRootForImportPath(ctx, pkg, web.SecureOnly)
+	require.NoError(t, err)
+	assert.Equal(t, "fossil", rr.VCS)
+
+	// Without a setting, the default rules still apply.
+	ctx.govcs, ctx.private = "", ""
+	_, err = repoRootForImportPath(ctx, pkg, web.SecureOnly)
+	assert.True(t, errors.Is(err, ErrPolicyDenied), "%v", err)
+	ctx.private = "chiselapp.com"
+	_, err = repoRootForImportPath(ctx, pkg, web.SecureOnly)
+	assert.NoError(t, err)
+
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	runGit(t, repo, "tag", "v1")
+	srcRoot := setupDir(t)
+	cloneInto(t, srcRoot, "github.com/tilt-dev/govcs-test", repo)
+	d := NewDownloader(srcRoot)
+	d.GOVCS = "github.com:off"
+	err = d.RefSync("github.com/tilt-dev/govcs-test", "v1")
+	assert.True(t, errors.Is(err, ErrPolicyDenied), "%v", err)
+	d.GOVCS = "public:git"
+	assert.NoError(t, d.RefSync("github.com/tilt-dev/govcs-test", "v1"))
+}
+
+func TestDefaultGOVCS(t *testing.T) {
+	setenv(t, "GOVCS", "")
+	setenv(t, "GOPRIVATE", "")
+
+	// Without a setting, public repositories may only use Git and
+	// Mercurial, as with the go command, and private ones anything.
+	ctx := newCmdContext(".", nil)
+	rr, err := repoRootForImportPath(ctx, "github.com/tilt-dev/govcs-test", web.SecureOnly)
+	require.NoError(t, err)
+	assert.Equal(t, "git", rr.VCS)
+
+	const pkg = "chiselapp.com/user/tilt/repository/govcs-test"
+	_, err = repoRootForImportPath(ctx, pkg, web.SecureOnly)
+	assert.True(t, errors.Is(err, ErrPolicyDenied), "%v", err)
+	assert.Contains(t, err.Error(), "GOVCS disallows using fossil for public "+pkg)
+
+	ctx.private = "chiselapp.com"
+	rr, err = repoRootForImportPath(ctx, pkg, web.SecureOnly)
+	require.NoError(t, err)
+	assert.Equal(t, "fossil", rr.VCS)
+
+	// A rule allowing every tool restores the old behavior.
+	ctx.private, ctx.govcs = "", "public:all"
+	_, err = repoRootForImportPath(ctx, pkg, web.SecureOnly)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,92 @@
+package get
+
+import (
+	"os"
+)
+
+// unsafeGitEnv lists environment variables that redirect git to another
+// repository, index or object store, or inject configuration.
+// Variables ending in "*" are prefixes.
+var unsafeGitEnv = []string{
+	"GIT_DIR",
+	"GIT_WORK_TREE",
+	"GIT_INDEX_FILE",
+	"GIT_OBJECT_DIRECTORY",
+	"GIT_ALTERNATE_OBJECT_DIRECTORIES",
+	"GIT_COMMON_DIR",
+	"GIT_NAMESPACE",
+	"GIT_EXEC_PATH",
+	"GIT_TEMPLATE_DIR",
+	"GIT_EXTERNAL_DIFF",
+	"GIT_PROTOCOL_FROM_USER",
+	"GIT_CONFIG*",
+}
+
+// hardenEnv returns env without the variables in unsafeGitEnv.
+func hardenEnv(env []string) []string {
+	var out []string
+	for _, kv := range env {
+		if !isUnsafeEnv(envKey(kv)) {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+func isUnsafeEnv(key string) bool {
+	return matchEnvName(unsafeGitEnv, key)
+}
+
+// gitHardenArgs are passed to every git command in hardened mode.
+var gitHardenArgs = []string{
+	"-c", "core.fsmonitor=false",
+	"-c", "core.hooksPath=" + os.DevNull,
+	"-c", "protocol.file.allow=never",
+	"-c", "protocol.ext.allow=never",
+}
+
+// gitHardenEnv is set for every git command in hardened mode.
+// It also blocks transports whose policy is "user", such as unknown
+// remote helpers, when a submodule rather than the caller asks for them.
+var gitHardenEnv = []string{"GIT_PROTOCOL_FROM_USER=0"}
+
+func gitHarden(args []string) []string {
+	return append(append([]string{}, gitHardenArgs...), args...)
+}
+
+// hgHooks are the hooks Mercurial runs while cloning, pulling and updating.
+var hgHooks = []string{
+	"changegroup", "incoming", "prechangegroup", "pretxnchangegroup",
+	"preupdate", "update", "pretxnopen", "pretxnclose", "txnclose", "txnabort",
+	"prelistkeys", "listkeys", "prepushkey", "pushkey",
+}
+
+// hgHardenEnv keeps Mercurial from reading a repository's .hg/hgrc at all,
+// and gives commands their plain, unconfigured output.
+var hgHardenEnv = []string{"HGRCSKIPREPO=1", "HGPLAIN=1"}
+
+func hgHarden(args []string) []string {
+	var out []string
+	for _, hook := range hgHooks {
+		out = append(out, "--config", "hooks."+hook+"=")
+	}
+	return append(out, args...)
+}
+
+// svnHarden never prompts, and skips the externals definitions
+// that checkouts and updates would otherwise follow.
+func svnHarden(args []string) []string {
+	out := []string{"--non-interactive"}
+	if len(args) > 0 {
+		switch args[0] {
+		case "checkout", "co", "update", "up", "status", "st":
+			return append(append(out, args[0], "--ignore-externals"), args[1:]...)
+		}
+	}
+	return append(out, args...)
+}
+
+// bzrHarden doesn't load plugins, which are arbitrary Python code.
+func bzrHarden(args []string) []string {
+	return append([]string{"--no-plugins"}, args...)
+}
@@ -0,0 +1,121 @@
+package get
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const hardenTestRoot = "github.com/tilt-dev/harden-test"
+
+// writeScript writes an executable shell script that creates marker.
+func writeScript(t *testing.T, path, marker string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, []byte("#!/bin/sh\ntouch '"+marker+"'\n"), 0755))
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestHardenedHooks(t *testing.T) {
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	runGit(t, repo, "tag", "v1")
+	srcRoot := setupDir(t)
+	dir := cloneInto(t, srcRoot, hardenTestRoot, repo)
+
+	// A tampered checkout whose config and hooks run programs.
+	marker := filepath.Join(tmpdir(t), "ran")
+	writeScript(t, filepath.Join(dir, ".git", "hooks", "post-checkout"), marker)
+	writeScript(t, filepath.Join(dir, ".git", "fsmonitor"), marker)
+	runGit(t, dir, "config", "core.fsmonitor", filepath.Join(dir, ".git", "fsmonitor"))
+
+	d := NewDownloader(srcRoot)
+	d.Hardened = true
+	require.NoError(t, d.RefSync(hardenTestRoot, "v1"))
+	_, err := d.Status(hardenTestRoot)
+	require.NoError(t, err)
+	assert.False(t, exists(marker), "hook ran in hardened mode")
+
+	d.Hardened = false
+	require.NoError(t, d.RefSync(hardenTestRoot, "v1"))
+	assert.True(t, exists(marker), "hook didn't run outside hardened mode")
+}
+
+func TestHardenedSubmoduleProtocols(t *testing.T) {
+	sub := gitRepo(t, map[string]string{"lib.star": "lib"})
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	runGit(t, repo, "-c", "protocol.file.allow=always", "submodule", "add", "-q", "file://"+sub, "lib")
+	runGit(t, repo, "commit", "-q", "-m", "add submodule")
+	runGit(t, repo, "tag", "v1")
+
+	srcRoot := setupDir(t)
+	dir := cloneInto(t, srcRoot, hardenTestRoot, repo)
+
+	// Allow local submodules, as a user's config might.
+	setenv(t, "GIT_CONFIG_COUNT", "1")
+	setenv(t, "GIT_CONFIG_KEY_0", "protocol.file.allow")
+	setenv(t, "GIT_CONFIG_VALUE_0", "always")
+
+	d := NewDownloader(srcRoot)
+	d.Hardened = true
+	err := d.RefSync(hardenTestRoot, "v1")
+	var exitErr *exec.ExitError
+	require.True(t, errors.As(err, &exitErr), "%v", err)
+	assert.Contains(t, string(exitErr.Stderr), "transport 'file' not allowed")
+	assert.False(t, exists(filepath.Join(dir, "lib", "lib.star")))
+
+	d.Hardened = false
+	require.NoError(t, d.RefSync(hardenTestRoot, "v1"))
+	assert.True(t, exists(filepath.Join(dir, "lib", "lib.star")))
+}
+
+func TestHardenedEnv(t *testing.T) {
+	env := hardenEnv([]string{
+		"HOME=/home/test",
+		"GIT_DIR=/elsewhere/.git",
+		"GIT_WORK_TREE=/elsewhere",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=core.fsmonitor",
+		"GIT_CONFIG_VALUE_0=/tmp/evil",
+		"GIT_CONFIG_PARAMETERS='core.hooksPath'='/tmp/evil'",
+		"GIT_TERMINAL_PROMPT=0",
+	})
+	assert.Equal(t, []string{"HOME=/home/test", "GIT_TERMINAL_PROMPT=0"}, env)
+
+	// A GIT_DIR from the caller's environment would point every command
+	// at the wrong repository.
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	runGit(t, repo, "tag", "v1")
+	srcRoot := setupDir(t)
+	cloneInto(t, srcRoot, hardenTestRoot, repo)
+	setenv(t, "GIT_DIR", filepath.Join(tmpdir(t), ".git"))
+
+	d := NewDownloader(srcRoot)
+	assert.Error(t, d.RefSync(hardenTestRoot, "v1"))
+	d.Hardened = true
+	assert.NoError(t, d.RefSync(hardenTestRoot, "v1"))
+}
+
+func TestHardenArgs(t *testing.T) {
+	assert.Equal(t,
+		[]string{"--non-interactive", "checkout", "--ignore-externals", "--", "https://example.com/svn", "dir"},
+		svnHarden([]string{"checkout", "--", "https://example.com/svn", "dir"}))
+	assert.Equal(t, []string{"--non-interactive", "info"}, svnHarden([]string{"info"}))
+
+	args := gitHarden([]string{"checkout", "v1"})
+	assert.Equal(t, []string{"checkout", "v1"}, args[len(args)-2:])
+	assert.Contains(t, args, "protocol.ext.allow=never")
+
+	args = hgHarden([]string{"pull"})
+	assert.Equal(t, "pull", args[len(args)-1])
+	assert.Contains(t, args, "hooks.update=")
+}
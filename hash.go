@@ -0,0 +1,177 @@
+package get
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// HashDir returns the h1: hash of the files in dir, naming each file
+// by its slash-separated path relative to dir, joined to prefix.
+//
+// This is the same hash that go.sum records for module content:
+// for a directory holding the extracted zip of example.com/mod@v1.2.3,
+// HashDir(dir, "example.com/mod@v1.2.3") matches that module's go.sum line.
+//
+// Unlike the go command, HashDir skips the metadata directories of every
+// known VCS (.git, .hg, .bzr, .svn and .fossil) at any depth, so that the hash
+// of a checkout depends only on its content. Symbolic links are skipped,
+// as they are left out of module zips, so that the hash never depends on
+// files outside dir.
+func HashDir(dir, prefix string) (string, error) {
+	files, err := hashFiles(dir)
+	if err != nil {
+		return "", err
+	}
+
+	summary := sha256.New()
+	for _, file := range files {
+		name := file
+		if prefix != "" {
+			name = path.Join(prefix, file)
+		}
+		if strings.Contains(name, "\n") {
+			return "", errors.New("dirhash: filenames with newlines are not supported")
+		}
+		sum, err := hashFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(summary, "%x  %s\n", sum, name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(summary.Sum(nil)), nil
+}
+
+// Hash returns the h1: hash of the downloaded package's directory,
+// as computed by HashDir with no prefix.
+func (d *Downloader) Hash(pkg string) (_ string, err error) {
+	defer wrapError(pkg, &err)
+	return HashDir(d.DestinationPath(pkg), "")
+}
+
+// VerifyHash checks that the downloaded package's directory has
+// the given h1: hash. If not, it returns a *ChecksumError listing
+// the files that differ from the checked-out revision.
+func (d *Downloader) VerifyHash(pkg, want string) (err error) {
+	defer wrapError(pkg, &err)
+
+	got, err := d.Hash(pkg)
+	if err != nil {
+		return err
+	}
+	if got == want {
+		return nil
+	}
+	cerr := &ChecksumError{Path: pkg, Want: want, Got: got}
+
+	// The hash alone can't say which files changed, but the VCS can say
+	// which files differ from the checked-out revision.
+	_, rr, err := d.repoRoot(pkg)
+	if err == nil {
+		root := filepath.Join(d.srcRoot, filepath.FromSlash(rr.Root))
+		if st, err := rr.vcs.status(d.toCmdContext(pkg, root), root); err == nil {
+			sub := strings.TrimPrefix(strings.TrimPrefix(pkg, rr.Root), "/")
+			for _, f := range append(st.Modified, st.Untracked...) {
+				if sub == "" {
+					cerr.Files = append(cerr.Files, f)
+				} else if strings.HasPrefix(f, sub+"/") {
+					cerr.Files = append(cerr.Files, strings.TrimPrefix(f, sub+"/"))
+				}
+			}
+			sort.Strings(cerr.Files)
+		}
+	}
+	return cerr
+}
+
+// A ChecksumError reports that a package's content
+// doesn't have the expected hash.
+type ChecksumError struct {
+	Path  string   // import path of the package
+	Want  string   // expected h1: hash
+	Got   string   // actual h1: hash
+	Files []string // files that differ from the checked-out revision, if known
+}
+
+func (e *ChecksumError) Error() string {
+	msg := fmt.Sprintf("%s: checksum mismatch\n\texpected: %s\n\tactual:   %s", e.Path, e.Want, e.Got)
+	if len(e.Files) > 0 {
+		msg += "\n\tchanged files: " + summarizePaths(e.Files)
+	}
+	return msg
+}
+
+// Is reports whether target is ErrChecksumMismatch.
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+func (e *ChecksumError) ImportPath() string {
+	return e.Path
+}
+
+// hashFiles returns the sorted, slash-separated paths
+// of the files in dir to include in its hash.
+func hashFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if isVCSMetadata(info.Name()) && file != dir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		// Walk doesn't follow symbolic links, so they aren't regular.
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func hashFile(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// isVCSMetadata reports whether name is the metadata directory
+// (or, for fossil, file) of a known VCS.
+func isVCSMetadata(name string) bool {
+	for _, vcs := range vcsList {
+		if name == "."+vcs.cmd {
+			return true
+		}
+	}
+	return false
+}
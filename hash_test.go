@@ -0,0 +1,104 @@
+package get
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+}
+
+func TestHashDir(t *testing.T) {
+	dir := tmpdir(t)
+	writeFiles(t, dir, map[string]string{
+		"Tiltfile":      "print(\"Hello world!\")\n",
+		"sub/README.md": "# hello\n",
+	})
+
+	// Expected values computed with golang.org/x/mod/sumdb/dirhash.
+	h, err := HashDir(dir, "example.com/mod@v1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, "h1:T1TZfrWZZKoHRZ++sUzl/CvcfOwn90kXczuVe0y9VbY=", h)
+
+	h, err = HashDir(dir, "")
+	require.NoError(t, err)
+	assert.Equal(t, "h1:FU8d4zqZWXEhOpoWckvRgqT3WosfxZd2OHhTtVSdBZw=", h)
+
+	// VCS metadata doesn't contribute to the hash.
+	writeFiles(t, dir, map[string]string{
+		".git/HEAD":          "ref: refs/heads/master\n",
+		"sub/.svn/entries":   "12\n",
+		"sub/.hg/requires":   "store\n",
+		".bzr/branch-format": "Bazaar-NG meta directory, format 1\n",
+		".fossil":            "SQLite format 3",
+	})
+	h, err = HashDir(dir, "")
+	require.NoError(t, err)
+	assert.Equal(t, "h1:FU8d4zqZWXEhOpoWckvRgqT3WosfxZd2OHhTtVSdBZw=", h)
+}
+
+func TestHashDirSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	dir := tmpdir(t)
+	writeFiles(t, dir, map[string]string{
+		"Tiltfile":      "print(\"Hello world!\")\n",
+		"sub/README.md": "# hello\n",
+	})
+	outside := filepath.Join(tmpdir(t), "secret")
+	require.NoError(t, ioutil.WriteFile(outside, []byte("v1"), 0644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "outside")))
+	require.NoError(t, os.Symlink("Tiltfile", filepath.Join(dir, "inside")))
+	require.NoError(t, os.Symlink("sub", filepath.Join(dir, "subdir")))
+
+	// Links are left out, as dirhash leaves them out of module zips,
+	// so files outside the tree don't change the hash.
+	h, err := HashDir(dir, "")
+	require.NoError(t, err)
+	assert.Equal(t, "h1:FU8d4zqZWXEhOpoWckvRgqT3WosfxZd2OHhTtVSdBZw=", h)
+	require.NoError(t, ioutil.WriteFile(outside, []byte("v2"), 0644))
+	h, err = HashDir(dir, "")
+	require.NoError(t, err)
+	assert.Equal(t, "h1:FU8d4zqZWXEhOpoWckvRgqT3WosfxZd2OHhTtVSdBZw=", h)
+}
+
+func TestVerifyHash(t *testing.T) {
+	repo := gitRepo(t, map[string]string{"ext/Tiltfile": "v1", "ext/lib.star": "lib", "README.md": "top"})
+	srcRoot := setupDir(t)
+	dir := cloneInto(t, srcRoot, "github.com/tilt-dev/hash-test", repo)
+	d := NewDownloader(srcRoot)
+	const pkg = "github.com/tilt-dev/hash-test/ext"
+
+	want, err := d.Hash(pkg)
+	require.NoError(t, err)
+	assert.NoError(t, d.VerifyHash(pkg, want))
+
+	writeFiles(t, dir, map[string]string{
+		"ext/Tiltfile": "tampered",
+		"ext/new.star": "new",
+		"README.md":    "outside the package",
+	})
+	err = d.VerifyHash(pkg, want)
+	assert.True(t, errors.Is(err, ErrChecksumMismatch), "got %v", err)
+
+	cerr, ok := err.(*ChecksumError)
+	if assert.True(t, ok, "got %T", err) {
+		assert.Equal(t, pkg, cerr.Path)
+		assert.Equal(t, want, cerr.Want)
+		assert.Equal(t, []string{"Tiltfile", "new.star"}, cerr.Files)
+	}
+}
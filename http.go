@@ -0,0 +1,42 @@
+package get
+
+import "github.com/tilt-dev/go-get/internal/web"
+
+// HTTPConfig configures the HTTP connections a Downloader makes itself,
+// for discovery and API requests: the certificate authorities to trust,
+// a client certificate, the proxy, timeouts and the user agent.
+//
+// CAFile, CertFile, KeyFile, UserAgent and ProxyURL apply to the version
+// control tools too. Git is given them as its http.sslCAInfo, http.sslCert,
+// http.sslKey and http.userAgent settings, through the environment
+// variables that override those, and every tool the proxy as http_proxy
+// and https_proxy. RootCAs, Proxy and Transport can't be passed on, and
+// apply only to the Downloader's own requests.
+type HTTPConfig = web.Config
+
+// httpEnv returns the environment that has v use the Downloader's HTTP
+// configuration.
+func (ctx cmdContext) httpEnv(v *vcsCmd) []string {
+	c := ctx.http
+	if c == nil {
+		return nil
+	}
+	var out []string
+	if c.ProxyURL != "" {
+		out = append(out, "http_proxy="+c.ProxyURL, "https_proxy="+c.ProxyURL)
+	}
+	if v.cmd != "git" {
+		return out
+	}
+	for _, kv := range []struct{ key, value string }{
+		{"GIT_SSL_CAINFO", c.CAFile},
+		{"GIT_SSL_CERT", c.CertFile},
+		{"GIT_SSL_KEY", c.KeyFile},
+		{"GIT_HTTP_USER_AGENT", c.UserAgent},
+	} {
+		if kv.value != "" {
+			out = append(out, kv.key+"="+kv.value)
+		}
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package get
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPConfigGit(t *testing.T) {
+	setenv(t, "HOME", tmpdir(t))
+	setenv(t, "GIT_CONFIG_NOSYSTEM", "1")
+
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	var (
+		mu     sync.Mutex
+		agents []string
+	)
+	handler := gitHandler(t, repo, nil)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents = append(agents, r.UserAgent())
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	url := srv.URL + "/" + filepath.Base(repo)
+
+	// Git doesn't trust the test server's certificate by default.
+	err := installFromURL(t, NewDownloader(setupDir(t)), url, repo)
+	assert.Contains(t, gitStderr(err), "certificate")
+
+	caFile := filepath.Join(tmpdir(t), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(caFile, data, 0644))
+
+	d := NewDownloader(setupDir(t))
+	d.HTTP = &HTTPConfig{CAFile: caFile, UserAgent: "go-get-test/1.0"}
+	require.NoError(t, installFromURL(t, d, url, repo))
+	assert.Equal(t, "v1", readFile(t, filepath.Join(d.DestinationPath(credTestRoot), "Tiltfile")))
+	require.NotEmpty(t, agents)
+	assert.Equal(t, "go-get-test/1.0", agents[len(agents)-1])
+}
+
+func TestHTTPEnv(t *testing.T) {
+	ctx := newCmdContext(".", nil)
+	assert.Nil(t, ctx.httpEnv(vcsGit))
+
+	ctx.http = &HTTPConfig{
+		CAFile:   "/etc/corp/ca.pem",
+		CertFile: "/etc/corp/client.pem",
+		KeyFile:  "/etc/corp/client.key",
+		ProxyURL: "http://proxy.corp:3128",
+	}
+	assert.Equal(t, []string{
+		"http_proxy=http://proxy.corp:3128",
+		"https_proxy=http://proxy.corp:3128",
+		"GIT_SSL_CAINFO=/etc/corp/ca.pem",
+		"GIT_SSL_CERT=/etc/corp/client.pem",
+		"GIT_SSL_KEY=/etc/corp/client.key",
+	}, ctx.httpEnv(vcsGit))
+
+	// Other tools only get the proxy.
+	assert.Equal(t, []string{
+		"http_proxy=http://proxy.corp:3128",
+		"https_proxy=http://proxy.corp:3128",
+	}, ctx.httpEnv(vcsHg))
+}
+
+func TestHTTPCacheDir(t *testing.T) {
+	d := NewDownloader("/src")
+	assert.Equal(t, filepath.Join("/src", ".go-get-cache", "http"), d.toCmdContext("", "").httpCache)
+	assert.NotNil(t, d.toCmdContext("", "").webClient().Cache)
+
+	d.HTTPCacheDir = "/var/cache/go-get"
+	assert.Equal(t, "/var/cache/go-get", d.toCmdContext("", "").httpCache)
+
+	d.HTTPCacheDir = "off"
+	assert.Equal(t, "", d.toCmdContext("", "").httpCache)
+	assert.Nil(t, d.toCmdContext("", "").webClient().Cache)
+}
@@ -0,0 +1,116 @@
+package get
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Interactive lets version control tools ask for credentials, such as a
+// password, an SSO token or an SSH key's passphrase, while a Downloader
+// runs them.
+//
+// Neither git nor ssh reads its prompts from standard input: they ask
+// through the programs named by GIT_ASKPASS and SSH_ASKPASS. In
+// interactive mode, each command gets an askpass program that forwards
+// its prompts to Ask, or else to the terminal given by Stdin and Stdout.
+// The bridge needs FIFOs, as on Linux, macOS and the BSDs. Elsewhere, such
+// as on Windows, commands run as they do outside interactive mode, and
+// fail only if they prompt.
+type Interactive struct {
+	// Ask, if non-nil, answers each prompt. The prompt is the tool's,
+	// such as "Password for 'https://alice@example.com': ". An error
+	// makes the tool's request for input fail.
+	Ask func(prompt string) (string, error)
+
+	// If Ask is nil, prompts are written to Stdout, and each is answered
+	// by a line read from Stdin. The caller is responsible for turning
+	// off echo while a secret is typed.
+	Stdin  io.Reader
+	Stdout io.Writer
+
+	// Stderr, if non-nil, also receives the standard error of every
+	// command, so that the user sees the messages that go with prompts.
+	Stderr io.Writer
+}
+
+// errNoTerminal is returned for a prompt when there is nothing to answer it.
+var errNoTerminal = errors.New("no terminal for prompt")
+
+// ask answers prompt with i's callback or terminal.
+func (i *Interactive) ask(prompt string) (string, error) {
+	if i.Ask != nil {
+		return i.Ask(prompt)
+	}
+	if i.Stdin == nil {
+		return "", errNoTerminal
+	}
+	if i.Stdout != nil {
+		if _, err := io.WriteString(i.Stdout, prompt); err != nil {
+			return "", err
+		}
+	}
+	return readLine(i.Stdin)
+}
+
+// readLine reads a line from r, without the line ending.
+// It reads a byte at a time, so that nothing after the line is consumed.
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(string(line), "\r"), nil
+}
+
+// askpassEnv returns the environment that points git and ssh at the
+// askpass program.
+func askpassEnv(program string) []string {
+	return []string{
+		"GIT_ASKPASS=" + program,
+		"SSH_ASKPASS=" + program,
+		// Use the program even if ssh has a terminal.
+		"SSH_ASKPASS_REQUIRE=force",
+	}
+}
+
+// startAskpass starts an askpass bridge for one command, returning the
+// environment for the command and a function that stops the bridge.
+func (ctx cmdContext) startAskpass() ([]string, func(), error) {
+	if ctx.interactive == nil {
+		return nil, func() {}, nil
+	}
+	ask := func(prompt string) (string, error) {
+		ctx.log(LevelDebug, "prompting", "prompt", strings.TrimSpace(prompt))
+		answer, err := ctx.interactive.ask(prompt)
+		if err != nil {
+			ctx.log(LevelWarn, "prompt failed", "prompt", strings.TrimSpace(prompt), "err", err)
+		}
+		return answer, err
+	}
+	a, err := newAskpass(ask)
+	if err != nil {
+		return nil, nil, fmt.Errorf("interactive mode: %v", err)
+	}
+	if a == nil {
+		ctx.log(LevelDebug, "interactive prompts are not supported on this system")
+		return nil, func() {}, nil
+	}
+	env := askpassEnv(a.program)
+	return env, a.close, nil
+}
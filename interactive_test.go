@@ -0,0 +1,114 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package get
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const authTestRoot = "github.com/tilt-dev/auth-test"
+
+// authRepo sets up a checkout of a repository served over HTTP that
+// only alice, with password "secret", may fetch. It returns the
+// repository, so that tests can add commits to fetch.
+func authRepo(t *testing.T, srcRoot string) string {
+	t.Helper()
+	// Keep the user's credential helpers out of it.
+	setenv(t, "HOME", tmpdir(t))
+	setenv(t, "GIT_CONFIG_NOSYSTEM", "1")
+
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	url := gitHTTPServer(t, repo, func(r *http.Request) bool {
+		user, pass, ok := r.BasicAuth()
+		return ok && user == "alice" && pass == "secret"
+	})
+	dest := cloneInto(t, srcRoot, authTestRoot, repo)
+	runGit(t, dest, "remote", "set-url", "origin", url)
+	gitCommit(t, repo, map[string]string{"Tiltfile": "v2"})
+	return repo
+}
+
+func TestInteractiveAsk(t *testing.T) {
+	srcRoot := setupDir(t)
+	authRepo(t, srcRoot)
+
+	d := NewDownloader(srcRoot)
+	_, err := d.Download(authTestRoot)
+	require.Error(t, err)
+
+	var prompts []string
+	d.Interactive = &Interactive{Ask: func(prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		if strings.HasPrefix(prompt, "Username") {
+			return "alice", nil
+		}
+		return "secret", nil
+	}}
+	_, err = d.Download(authTestRoot)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", readFile(t, filepath.Join(d.DestinationPath(authTestRoot), "Tiltfile")))
+	require.Len(t, prompts, 2)
+	assert.Contains(t, prompts[0], "Username for 'http://127.0.0.1:")
+	assert.Contains(t, prompts[1], "Password for 'http://alice@127.0.0.1:")
+}
+
+func TestInteractiveAskError(t *testing.T) {
+	srcRoot := setupDir(t)
+	authRepo(t, srcRoot)
+
+	d := NewDownloader(srcRoot)
+	d.Interactive = &Interactive{Ask: func(prompt string) (string, error) {
+		return "", errors.New("cancelled")
+	}}
+	_, err := d.Download(authTestRoot)
+	assert.Error(t, err)
+}
+
+func TestInteractiveTerminal(t *testing.T) {
+	srcRoot := setupDir(t)
+	authRepo(t, srcRoot)
+
+	var stdout, stderr bytes.Buffer
+	d := NewDownloader(srcRoot)
+	d.Interactive = &Interactive{
+		Stdin:  strings.NewReader("alice\nsecret\n"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	_, err := d.Download(authTestRoot)
+	require.NoError(t, err)
+	assert.Contains(t, stdout.String(), "Username for ")
+	assert.Contains(t, stdout.String(), "Password for ")
+
+	// Wrong answers fail the command, whose stderr the caller sees.
+	srcRoot = setupDir(t)
+	authRepo(t, srcRoot)
+	d = NewDownloader(srcRoot)
+	d.Interactive = &Interactive{
+		Stdin:  strings.NewReader("alice\nwrong\n"),
+		Stderr: &stderr,
+	}
+	_, err = d.Download(authTestRoot)
+	assert.Error(t, err)
+	assert.Contains(t, stderr.String(), "Authentication failed")
+}
+
+func TestReadLine(t *testing.T) {
+	r := strings.NewReader("alice\r\nsecret\nlast")
+	for _, want := range []string{"alice", "secret", "last"} {
+		line, err := readLine(r)
+		require.NoError(t, err)
+		assert.Equal(t, want, line)
+	}
+	_, err := readLine(r)
+	assert.Error(t, err)
+}
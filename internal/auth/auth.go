@@ -5,19 +5,215 @@
 // Package auth provides access to user-provided authentication credentials.
 package auth
 
-import "net/http"
-
-// AddCredentials fills in the user's credentials for req, if any.
-// The return value reports whether any matching credentials were found.
-func AddCredentials(req *http.Request) (added bool) {
-	// TODO(golang.org/issue/26232): Support arbitrary user-provided credentials.
-	netrcOnce.Do(readNetrc)
-	for _, l := range netrc {
-		if l.machine == req.URL.Host {
-			req.SetBasicAuth(l.login, l.password)
-			return true
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// Credentials authenticate requests to a server.
+type Credentials struct {
+	// Username and Password, if either is set, are sent with
+	// basic authentication.
+	Username string
+	Password string
+
+	// Header holds additional headers to send, such as an
+	// Authorization header with a bearer token.
+	Header http.Header
+
+	// report, if non-nil, tells the source of the credentials
+	// whether the server accepted them.
+	report func(accepted bool)
+}
+
+// Approve reports that a server accepted c, so that their source can
+// remember them. Credentials without such a source ignore it.
+func (c *Credentials) Approve() {
+	if c.report != nil {
+		c.report(true)
+	}
+}
+
+// Reject reports that a server refused c, so that their source can
+// forget them.
+func (c *Credentials) Reject() {
+	if c.report != nil {
+		c.report(false)
+	}
+}
+
+// Headers returns the headers that carry c.
+func (c *Credentials) Headers() http.Header {
+	h := make(http.Header)
+	if c.Username != "" || c.Password != "" {
+		h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password)))
+	}
+	for k, vs := range c.Header {
+		h[http.CanonicalHeaderKey(k)] = append([]string(nil), vs...)
+	}
+	return h
+}
+
+// Apply sets the headers that carry c on req.
+func (c *Credentials) Apply(req *http.Request) {
+	for k, vs := range c.Headers() {
+		req.Header[k] = vs
+	}
+}
+
+// A Provider supplies the credentials for requests.
+//
+// Providers are consulted for every request, rather than once, so that
+// changes to the underlying credentials take effect without a restart.
+type Provider interface {
+	// Credentials returns the credentials for a request to u,
+	// or nil if it has none.
+	Credentials(u *url.URL) (*Credentials, error)
+}
+
+// A Refresher is a Provider that can be asked again for credentials
+// after a server refuses a request.
+type Refresher interface {
+	Provider
+
+	// Refresh returns the credentials to retry a request to u with,
+	// given the server's response res, or nil if there are none.
+	Refresh(u *url.URL, res *http.Response) (*Credentials, error)
+}
+
+// Default is the provider used when none is given: the GOAUTH
+// environment variable, which defaults to the user's .netrc file.
+var Default Provider = &GoAuth{}
+
+// AddCredentials fills in the credentials p has for req, if any.
+// If p is nil, Default is used.
+// It returns the credentials added, or nil if none matched, so that
+// the caller can report whether the server accepted them.
+func AddCredentials(p Provider, req *http.Request) (*Credentials, error) {
+	if p == nil {
+		p = Default
+	}
+	c, err := p.Credentials(req.URL)
+	if err != nil || c == nil {
+		return nil, err
+	}
+	c.Apply(req)
+	return c, nil
+}
+
+// RetryCredentials fills in the credentials to retry req with after a
+// server responded to an earlier attempt with res, if p can refresh its
+// credentials. If p is nil, Default is used.
+// It returns the credentials added, or nil if there are none.
+func RetryCredentials(p Provider, req *http.Request, res *http.Response) (*Credentials, error) {
+	if p == nil {
+		p = Default
+	}
+	r, ok := p.(Refresher)
+	if !ok {
+		return nil, nil
+	}
+	c, err := r.Refresh(req.URL, res)
+	if err != nil || c == nil {
+		return nil, err
+	}
+	c.Apply(req)
+	return c, nil
+}
+
+// A Chain consults each of its providers in turn,
+// returning the first credentials found.
+type Chain []Provider
+
+func (c Chain) Credentials(u *url.URL) (*Credentials, error) {
+	var firstErr error
+	for _, p := range c {
+		creds, err := p.Credentials(u)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if creds != nil {
+			return creds, nil
 		}
 	}
+	return nil, firstErr
+}
 
+// Refresh asks each of the providers that can refresh in turn,
+// returning the first credentials found.
+func (c Chain) Refresh(u *url.URL, res *http.Response) (*Credentials, error) {
+	var firstErr error
+	for _, p := range c {
+		r, ok := p.(Refresher)
+		if !ok {
+			continue
+		}
+		creds, err := r.Refresh(u, res)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if creds != nil {
+			return creds, nil
+		}
+	}
+	return nil, firstErr
+}
+
+// Static holds fixed credentials, keyed by host, with or without a port.
+type Static map[string]*Credentials
+
+func (s Static) Credentials(u *url.URL) (*Credentials, error) {
+	if c, ok := s[u.Host]; ok {
+		return c, nil
+	}
+	return s[u.Hostname()], nil
+}
+
+// EnvToken supplies a token read from an environment variable on every
+// request, so that a refreshed token is used as soon as it is set.
+type EnvToken struct {
+	// Var is the name of the variable, such as "GITHUB_TOKEN".
+	// Requests get no credentials while it is unset or empty.
+	Var string
+
+	// Hosts lists the hosts, with or without a port,
+	// that the token is sent to.
+	Hosts []string
+
+	// Username, if set, sends the token as the password of basic
+	// authentication, as some git hosts require. Otherwise the token
+	// is sent as a bearer token.
+	Username string
+}
+
+func (e *EnvToken) Credentials(u *url.URL) (*Credentials, error) {
+	if !matchHost(e.Hosts, u) {
+		return nil, nil
+	}
+	token := os.Getenv(e.Var)
+	if token == "" {
+		return nil, nil
+	}
+	if e.Username != "" {
+		return &Credentials{Username: e.Username, Password: token}, nil
+	}
+	return &Credentials{Header: http.Header{"Authorization": {"Bearer " + token}}}, nil
+}
+
+// matchHost reports whether u's host is one of hosts.
+func matchHost(hosts []string, u *url.URL) bool {
+	for _, h := range hosts {
+		if h == u.Host || h == u.Hostname() {
+			return true
+		}
+	}
 	return false
 }
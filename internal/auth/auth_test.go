@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+)
+
+type errProvider struct{}
+
+func (errProvider) Credentials(u *url.URL) (*Credentials, error) {
+	return nil, errors.New("broken")
+}
+
+func TestChain(t *testing.T) {
+	u := &url.URL{Scheme: "https", Host: "example.com:8443"}
+	alice := &Credentials{Username: "alice"}
+	chain := Chain{errProvider{}, Static{"other.com": {}}, Static{"example.com": alice}}
+	c, err := chain.Credentials(u)
+	if err != nil || c != alice {
+		t.Errorf("Credentials = %v, %v; want alice, nil", c, err)
+	}
+
+	// With no credentials found, the first error is reported.
+	c, err = chain[:2].Credentials(u)
+	if err == nil || c != nil {
+		t.Errorf("Credentials = %v, %v; want nil, error", c, err)
+	}
+}
+
+func TestEnvToken(t *testing.T) {
+	const name = "GO_GET_AUTH_TEST_TOKEN"
+	defer os.Unsetenv(name)
+	e := &EnvToken{Var: name, Hosts: []string{"example.com"}}
+	u := &url.URL{Scheme: "https", Host: "example.com"}
+
+	if c, _ := e.Credentials(u); c != nil {
+		t.Errorf("Credentials with %s unset = %v; want nil", name, c)
+	}
+	os.Setenv(name, "tok")
+	c, _ := e.Credentials(u)
+	if got := c.Headers().Get("Authorization"); got != "Bearer tok" {
+		t.Errorf("Authorization = %q; want %q", got, "Bearer tok")
+	}
+	if c, _ := e.Credentials(&url.URL{Scheme: "https", Host: "other.com"}); c != nil {
+		t.Errorf("Credentials for other host = %v; want nil", c)
+	}
+
+	e.Username = "x-access-token"
+	c, _ = e.Credentials(u)
+	req, _ := http.NewRequest("GET", "https://example.com/", nil)
+	c.Apply(req)
+	if user, pass, ok := req.BasicAuth(); !ok || user != "x-access-token" || pass != "tok" {
+		t.Errorf("BasicAuth = %q, %q, %v; want x-access-token, tok, true", user, pass, ok)
+	}
+}
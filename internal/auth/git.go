@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// GitHelper supplies the credentials from the user's git credential
+// helpers, such as osxkeychain, libsecret or Git Credential Manager,
+// using the protocol of git credential fill, approve and reject.
+//
+// Credentials are filled once per server, and kept, or their absence
+// remembered, until the server refuses them. Filling never prompts:
+// a server the helpers have no credentials for gets none. As the
+// credentials are per server, helpers are not given request paths.
+// Filled credentials are approved the first time a server accepts
+// them, not on every request.
+type GitHelper struct {
+	// Git is the git binary to run. If empty, it is "git".
+	Git string
+
+	mu    sync.Mutex
+	cache map[string]*gitFilled // protocol://host -> filled credential
+}
+
+// A gitFilled is the result of filling the credential for a server.
+type gitFilled struct {
+	cred     gitCredential
+	approved bool // git credential approve has run for cred
+}
+
+// A gitCredential is a credential description in the format of
+// git credential: key=value lines, in order.
+type gitCredential []string
+
+func (g *GitHelper) Credentials(u *url.URL) (*Credentials, error) {
+	key := u.Scheme + "://" + u.Host
+	g.mu.Lock()
+	f, ok := g.cache[key]
+	g.mu.Unlock()
+	if !ok {
+		query := gitCredential{"protocol=" + u.Scheme, "host=" + u.Host}
+		f = new(gitFilled)
+		// If fill fails, either no helper has credentials or git
+		// isn't installed, and requests to the server go without.
+		out, err := g.run("fill", query)
+		if err == nil {
+			f.cred = parseGitCredential(out)
+		}
+		g.mu.Lock()
+		if g.cache == nil {
+			g.cache = make(map[string]*gitFilled)
+		}
+		g.cache[key] = f
+		g.mu.Unlock()
+	}
+
+	cred := f.cred
+	user, pass := cred.get("username"), cred.get("password")
+	if user == "" && pass == "" {
+		return nil, nil
+	}
+	return &Credentials{
+		Username: user,
+		Password: pass,
+		report: func(accepted bool) {
+			action := "approve"
+			g.mu.Lock()
+			current := g.cache[key] == f
+			if accepted {
+				// Approve a fill once, and not at all once it has
+				// been rejected and dropped.
+				if !current || f.approved {
+					g.mu.Unlock()
+					return
+				}
+				f.approved = true
+			} else {
+				action = "reject"
+				if current {
+					delete(g.cache, key)
+				}
+			}
+			g.mu.Unlock()
+			// A helper that can't store or erase the credential
+			// is no reason to fail the request.
+			_, _ = g.run(action, cred)
+		},
+	}, nil
+}
+
+// run runs git credential action with cred as input.
+func (g *GitHelper) run(action string, cred gitCredential) ([]byte, error) {
+	git := g.Git
+	if git == "" {
+		git = "git"
+	}
+	cmd := exec.Command(git, "credential", action)
+	cmd.Stdin = strings.NewReader(strings.Join(cred, "\n") + "\n\n")
+	// Never ask the user: an empty GIT_ASKPASS also stops git
+	// from falling back to core.askPass and SSH_ASKPASS.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=")
+	return cmd.Output()
+}
+
+// parseGitCredential parses the output of git credential fill.
+func parseGitCredential(out []byte) gitCredential {
+	var cred gitCredential
+	for _, line := range strings.Split(string(out), "\n") {
+		if line == "" {
+			break
+		}
+		if strings.Contains(line, "=") {
+			cred = append(cred, line)
+		}
+	}
+	return cred
+}
+
+// get returns the value of key in c.
+func (c gitCredential) get(key string) string {
+	for _, line := range c {
+		if strings.HasPrefix(line, key+"=") {
+			return line[len(key)+1:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeHelper configures git, for the rest of the test, with a credential
+// helper that knows alice's password for example.com and logs its calls.
+// It returns the path of the log.
+func fakeHelper(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir, err := ioutil.TempDir("", "auth-git-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	log := filepath.Join(dir, "log")
+	helper := filepath.Join(dir, "helper")
+	script := `#!/bin/sh
+input=$(cat)
+host=$(printf '%s\n' "$input" | sed -n 's/^host=//p')
+printf '%s %s\n' "$1" "$host" >> '` + log + `'
+if [ "$1" = get ] && [ "$host" = example.com ]; then
+	echo username=alice
+	echo password=secret
+fi
+`
+	if err := ioutil.WriteFile(helper, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		"HOME":                dir,
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"GIT_CONFIG_COUNT":    "1",
+		"GIT_CONFIG_KEY_0":    "credential.helper",
+		"GIT_CONFIG_VALUE_0":  helper,
+	} {
+		old, had := os.LookupEnv(k)
+		os.Setenv(k, v)
+		k := k
+		t.Cleanup(func() {
+			if had {
+				os.Setenv(k, old)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+	return log
+}
+
+func readLog(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return strings.Fields(strings.Replace(string(data), " ", "@", -1))
+}
+
+func TestGitHelper(t *testing.T) {
+	log := fakeHelper(t)
+	g := &GitHelper{}
+	u := &url.URL{Scheme: "https", Host: "example.com", Path: "/api"}
+
+	c, err := g.Credentials(u)
+	if err != nil || c == nil {
+		t.Fatalf("Credentials = %v, %v; want alice's", c, err)
+	}
+	if c.Username != "alice" || c.Password != "secret" {
+		t.Errorf("Credentials = %s:%s; want alice:secret", c.Username, c.Password)
+	}
+
+	// The credentials are filled once, approved once however often
+	// they are accepted, and rejected.
+	again, err := g.Credentials(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Approve()
+	again.Approve()
+	c.Reject()
+	want := []string{"get@example.com", "store@example.com", "erase@example.com"}
+	if got := readLog(t, log); !reflect.DeepEqual(got, want) {
+		t.Errorf("helper calls = %q; want %q", got, want)
+	}
+
+	// Rejected credentials are filled again, and the new fill is
+	// approved, unlike the rejected one.
+	c2, err := g.Credentials(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Approve()
+	c2.Approve()
+	want = append(want, "get@example.com", "store@example.com")
+	if got := readLog(t, log); !reflect.DeepEqual(got, want) {
+		t.Errorf("helper calls = %q; want %q", got, want)
+	}
+
+	c, err = g.Credentials(&url.URL{Scheme: "https", Host: "other.com"})
+	if err != nil || c != nil {
+		t.Errorf("Credentials for other.com = %v, %v; want nil, nil", c, err)
+	}
+}
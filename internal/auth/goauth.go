@@ -0,0 +1,473 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// GoAuth supplies credentials as the go command's GOAUTH setting does:
+// a semicolon-separated list of authentication commands, each of which
+// gives headers for HTTPS URL prefixes. The headers of the longest
+// matching prefix are used. See 'go help goauth'.
+//
+// The commands are:
+//
+//	off
+//		Disables authentication.
+//	netrc
+//		Uses credentials from NETRC or the .netrc file in the home directory.
+//	git dir
+//		Runs 'git credential fill' in dir and uses its credentials, which
+//		are approved or rejected as servers accept or refuse them.
+//	command
+//		Executes the given command (a space-separated argument list) and
+//		attaches the provided headers to HTTPS requests.
+//
+// Every command runs before the first request. After a request fails
+// with a 4xx status, the commands run again, given the URL and the
+// response, and the request is retried.
+type GoAuth struct {
+	// Setting is the GOAUTH value. If empty, $GOAUTH is used,
+	// and if that is empty too, "netrc".
+	Setting string
+
+	// Warn, if non-nil, is told of problems with the .netrc file
+	// that don't stop it from being used. See Netrc.
+	Warn func(msg string, keyvals ...interface{})
+
+	// UseNetrcDefault has the netrc command apply the .netrc file's
+	// default entry to hosts without one, as Netrc.UseDefault does.
+	UseNetrcDefault bool
+
+	mu         sync.Mutex
+	setting    string                  // setting the cache was filled with
+	ran        bool                    // whether the commands have run for setting
+	cache      map[string]*Credentials // prefix without "https://" -> credentials
+	netrc      Netrc                   // for the netrc command
+	netrcGen   int                     // netrc.gen when the commands last ran
+	netrcLines []netrcLine             // entries the netrc command read
+}
+
+func (g *GoAuth) Credentials(u *url.URL) (*Credentials, error) {
+	if u.Scheme != "https" {
+		return nil, nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.netrc.Warn = g.Warn
+	setting := g.effectiveSetting()
+	if setting == "off" {
+		return nil, nil
+	}
+	if !g.ran || setting != g.setting || g.netrcChanged() {
+		// Run all GOAUTH commands at least once,
+		// and again if the .netrc file changes.
+		g.setting, g.cache, g.netrcLines = setting, nil, nil
+		g.netrc.load()
+		g.netrcGen = g.netrc.gen
+		if err := g.run(setting, nil, ""); err != nil {
+			return nil, err
+		}
+		g.ran = true
+	}
+	return g.lookup(u), nil
+}
+
+// Refresh runs the commands again for u, given the response res from
+// a failed request, and returns the credentials to retry with.
+func (g *GoAuth) Refresh(u *url.URL, res *http.Response) (*Credentials, error) {
+	if u.Scheme != "https" {
+		return nil, nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.netrc.Warn = g.Warn
+	setting := g.effectiveSetting()
+	if setting == "off" {
+		return nil, nil
+	}
+	if setting != g.setting {
+		g.setting, g.cache, g.netrcLines = setting, nil, nil
+	}
+	if err := g.run(setting, res, u.String()); err != nil {
+		return nil, err
+	}
+	g.ran = true
+	return g.lookup(u), nil
+}
+
+// lookup returns the credentials for u: those stored for the longest
+// prefix of u, or else, if the netrc command ran, those of the .netrc
+// entry for u's host without a port or, if UseNetrcDefault is set, of
+// the default entry.
+func (g *GoAuth) lookup(u *url.URL) *Credentials {
+	if c := g.load(u.String()); c != nil {
+		return c
+	}
+	if l := matchNetrc(g.netrcLines, u, g.UseNetrcDefault); l != nil {
+		return &Credentials{Username: l.login, Password: l.password}
+	}
+	return nil
+}
+
+// netrcChanged reports whether the .netrc file has changed
+// since the commands last ran.
+func (g *GoAuth) netrcChanged() bool {
+	if _, err := g.netrc.load(); err != nil {
+		return false
+	}
+	return g.netrc.gen != g.netrcGen
+}
+
+func (g *GoAuth) effectiveSetting() string {
+	setting := g.Setting
+	if setting == "" {
+		setting = os.Getenv("GOAUTH")
+	}
+	if setting == "" {
+		setting = "netrc"
+	}
+	return setting
+}
+
+// run executes the authentication commands in setting, handling 'off',
+// 'netrc', and 'git' methods specially, and stores the credentials
+// they give. It reports malformed settings; the errors of individual
+// commands are ignored, as the go command does, so that another
+// command may still succeed.
+func (g *GoAuth) run(setting string, res *http.Response, url string) error {
+	cmds := strings.Split(setting, ";")
+	// The commands are processed in reverse order to prioritize
+	// credentials in the order they were specified.
+	for i := len(cmds) - 1; i >= 0; i-- {
+		command := strings.TrimSpace(cmds[i])
+		words := strings.Fields(command)
+		if len(words) == 0 {
+			return fmt.Errorf("GOAUTH encountered an empty command (GOAUTH=%s)", setting)
+		}
+		switch words[0] {
+		case "off":
+			if len(cmds) != 1 {
+				return fmt.Errorf("GOAUTH=off cannot be combined with other authentication commands (GOAUTH=%s)", setting)
+			}
+			return nil
+		case "netrc":
+			lines, err := g.netrc.load()
+			g.netrcGen = g.netrc.gen
+			if err != nil {
+				continue
+			}
+			// Process lines in reverse so that if the same machine is listed
+			// multiple times, we end up saving the earlier one
+			// (overwriting later ones). The default entry, and entries
+			// for the host on another port, are left to lookup.
+			for i := len(lines) - 1; i >= 0; i-- {
+				l := lines[i]
+				if l.machine != "" {
+					g.store(l.machine, &Credentials{Username: l.login, Password: l.password})
+				}
+			}
+			g.netrcLines = lines
+		case "git":
+			if len(words) != 2 {
+				return fmt.Errorf("GOAUTH=git dir method requires an absolute path to the git working directory")
+			}
+			dir := words[1]
+			if !filepath.IsAbs(dir) {
+				return fmt.Errorf("GOAUTH=git dir method requires an absolute path to the git working directory, dir is not absolute")
+			}
+			fs, err := os.Stat(dir)
+			if err != nil {
+				return fmt.Errorf("GOAUTH=git encountered an error; cannot stat %s: %v", dir, err)
+			}
+			if !fs.IsDir() {
+				return fmt.Errorf("GOAUTH=git dir method requires an absolute path to the git working directory, dir is not a directory")
+			}
+			if url == "" {
+				// Skip the initial run, since 'git credential' provides no
+				// way to enumerate credentials; wait for a specific url.
+				continue
+			}
+			prefix, creds, err := runGitAuth(dir, url)
+			if err == nil {
+				g.store(prefix, creds)
+			}
+		default:
+			credentials, err := runAuthCommand(command, url, res)
+			if err != nil {
+				continue
+			}
+			for prefix, header := range credentials {
+				if len(header) == 0 {
+					g.store(prefix, nil)
+				} else {
+					g.store(prefix, &Credentials{Header: header})
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// load returns the credentials stored for the longest prefix of url.
+func (g *GoAuth) load(url string) *Credentials {
+	currentPrefix := strings.TrimPrefix(url, "https://")
+	currentPrefix = strings.TrimSuffix(currentPrefix, "/")
+
+	// Iteratively try prefixes, moving up the path hierarchy.
+	// E.g. example.com/foo/bar, example.com/foo, example.com
+	for {
+		if c, ok := g.cache[currentPrefix]; ok {
+			return c
+		}
+		lastSlash := strings.LastIndexByte(currentPrefix, '/')
+		if lastSlash == -1 {
+			return nil
+		}
+		currentPrefix = currentPrefix[:lastSlash]
+	}
+}
+
+// store caches or, if creds is nil, removes the credentials
+// for the given URL prefix.
+func (g *GoAuth) store(prefix string, creds *Credentials) {
+	// Trim "https://" prefix to match the format used in .netrc files.
+	prefix = strings.TrimPrefix(prefix, "https://")
+	prefix = strings.TrimSuffix(prefix, "/")
+	if creds == nil {
+		delete(g.cache, prefix)
+		return
+	}
+	if g.cache == nil {
+		g.cache = make(map[string]*Credentials)
+	}
+	g.cache[prefix] = creds
+}
+
+// runAuthCommand executes a user provided GOAUTH command, parses its output, and
+// returns a mapping of prefix → http.Header.
+// res, if non-nil, is written to the command's stdin.
+func runAuthCommand(command string, url string, res *http.Response) (map[string]http.Header, error) {
+	words, err := splitQuoted(command)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse GOAUTH command %s: %v", command, err)
+	}
+	cmd := exec.Command(words[0], words[1:]...)
+	if url != "" {
+		cmd.Args = append(cmd.Args, url)
+	}
+	stderr := new(strings.Builder)
+	cmd.Stderr = stderr
+	if res != nil {
+		cmd.Stdin = strings.NewReader(formatResponse(res))
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not run command %s: %v\n%s", command, err, stderr)
+	}
+	credentials, err := parseUserAuth(string(out))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse output of GOAUTH command %s: %v", command, err)
+	}
+	return credentials, nil
+}
+
+// parseUserAuth parses the output from a GOAUTH command and
+// returns a mapping of prefix → http.Header without the leading "https://"
+// or an error if the data does not follow the expected format.
+// Returns a nil error and an empty map if the data is empty.
+// See the expected format in 'go help goauth'.
+func parseUserAuth(data string) (map[string]http.Header, error) {
+	credentials := make(map[string]http.Header)
+	for data != "" {
+		var line string
+		var ok bool
+		var urls []string
+		// Parse URLS first.
+		for {
+			line, data, ok = cut(data, "\n")
+			if !ok {
+				return nil, fmt.Errorf("invalid format: missing empty line after URLs")
+			}
+			if line == "" {
+				break
+			}
+			u, err := url.ParseRequestURI(line)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse URL %s: %v", line, err)
+			}
+			urls = append(urls, u.String())
+		}
+		// Parse Headers second.
+		header := make(http.Header)
+		for {
+			line, data, ok = cut(data, "\n")
+			if !ok {
+				return nil, fmt.Errorf("invalid format: missing empty line after headers")
+			}
+			if line == "" {
+				break
+			}
+			name, value, ok := cut(line, ": ")
+			value = strings.TrimSpace(value)
+			if !ok || !validHeaderFieldName(name) || !validHeaderFieldValue(value) {
+				return nil, fmt.Errorf("invalid format: invalid header line")
+			}
+			header.Add(name, value)
+		}
+		for _, p := range urls {
+			p = strings.TrimPrefix(p, "https://")
+			credentials[p] = header.Clone() // Clone the header to avoid sharing
+		}
+	}
+	return credentials, nil
+}
+
+// formatResponse formats res as the input of a GOAUTH command:
+// the status line and headers, followed by a blank line.
+func formatResponse(res *http.Response) string {
+	var output strings.Builder
+	output.WriteString(res.Proto + " " + res.Status + "\n")
+	for k, v := range res.Header {
+		output.WriteString(k + ": " + strings.Join(v, ", ") + "\n")
+	}
+	output.WriteString("\n")
+	return output.String()
+}
+
+// runGitAuth retrieves credentials for the given url using
+// 'git credential fill' in dir. It returns the matching credential
+// prefix and the credentials, which approve or reject themselves with
+// 'git credential approve/reject' when the server accepts or refuses them.
+func runGitAuth(dir, url string) (string, *Credentials, error) {
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("url=%s\n", url))
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", nil, fmt.Errorf("'git credential fill' failed (url=%s): %v\n%s", url, err, out)
+	}
+	parsedPrefix, username, password := parseGitAuth(out)
+	if parsedPrefix == "" {
+		return "", nil, fmt.Errorf("'git credential fill' failed for url=%s, could not parse url", url)
+	}
+	// Check that the URL Git gave us is a prefix of the one we requested.
+	if !strings.HasPrefix(url, parsedPrefix) {
+		return "", nil, fmt.Errorf("requested a credential for %s, but 'git credential fill' provided one for %s", url, parsedPrefix)
+	}
+	creds := &Credentials{
+		Username: username,
+		Password: password,
+		report: func(accepted bool) {
+			action := "reject"
+			if accepted {
+				action = "approve"
+			}
+			cmd := exec.Command("git", "credential", action)
+			cmd.Dir = dir
+			cmd.Stdin = bytes.NewReader(out)
+			cmd.Run() // ignore error
+		},
+	}
+	return parsedPrefix, creds, nil
+}
+
+// parseGitAuth parses the output of 'git credential fill', extracting
+// the URL prefix, user, and password.
+// Any of these values may be empty if parsing fails.
+func parseGitAuth(data []byte) (parsedPrefix, username, password string) {
+	prefix := new(url.URL)
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "protocol":
+			prefix.Scheme = value
+		case "host":
+			prefix.Host = value
+		case "path":
+			prefix.Path = value
+		case "username":
+			username = value
+		case "password":
+			password = value
+		case "url":
+			// Write to a local variable instead of updating prefix directly:
+			// if the url field is malformed, we don't want to invalidate
+			// information parsed from the protocol, host, and path fields.
+			u, err := url.ParseRequestURI(value)
+			if err != nil {
+				continue
+			}
+			prefix = u
+		}
+	}
+	return prefix.String(), username, password
+}
+
+// splitQuoted splits s into a list of fields,
+// allowing single or double quotes around elements.
+// There is no unescaping or other processing within
+// quoted fields.
+func splitQuoted(s string) ([]string, error) {
+	// Split fields allowing '' or "" around elements.
+	// Quotes further inside the string do not count.
+	var f []string
+	for len(s) > 0 {
+		for len(s) > 0 && isSpaceByte(s[0]) {
+			s = s[1:]
+		}
+		if len(s) == 0 {
+			break
+		}
+		// Accepted quoted string. No unescaping inside.
+		if s[0] == '"' || s[0] == '\'' {
+			quote := s[0]
+			s = s[1:]
+			i := 0
+			for i < len(s) && s[i] != quote {
+				i++
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated %c string", quote)
+			}
+			f = append(f, s[:i])
+			s = s[i+1:]
+			continue
+		}
+		i := 0
+		for i < len(s) && !isSpaceByte(s[i]) {
+			i++
+		}
+		f = append(f, s[:i])
+		s = s[i:]
+	}
+	return f, nil
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// cut slices s around the first instance of sep,
+// returning the text before and after sep.
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/tilt-dev/go-get/internal/module"
+)
+
+// A HeaderRule sends a header, such as a bearer token or GitLab's
+// PRIVATE-TOKEN, to the servers matching a pattern. The value is read
+// from an environment variable or a file on every request, so that a
+// refreshed token is used as soon as it is written. The header isn't
+// passed on when a server redirects to another host.
+type HeaderRule struct {
+	// Hosts is a comma-separated list of glob patterns, in the syntax
+	// of GOPRIVATE, matching the host, and optionally a path prefix,
+	// of the URLs the header is sent to: "gitlab.example.com",
+	// "*.corp.example.com" or "github.com/my-org". A pattern without a
+	// port matches the host on any port.
+	Hosts string
+
+	// Name is the name of the header. If empty, it is "Authorization".
+	Name string
+
+	// Prefix, if set, is written before the value with a space,
+	// as in "Bearer".
+	Prefix string
+
+	// Env names the environment variable holding the value,
+	// and File the file holding it, with surrounding space trimmed.
+	// Env takes precedence. While neither has a value, the rule
+	// sends nothing.
+	Env  string
+	File string
+}
+
+// value returns the header value r sends, or "" if it has none.
+func (r *HeaderRule) value() (string, error) {
+	v, src := "", ""
+	if r.Env != "" {
+		v, src = os.Getenv(r.Env), "$"+r.Env
+	}
+	if v == "" && r.File != "" {
+		data, err := ioutil.ReadFile(r.File)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		v, src = strings.TrimSpace(string(data)), r.File
+	}
+	if v == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(v, "\r\n") {
+		return "", fmt.Errorf("%s header from %s contains a newline", r.name(), src)
+	}
+	if r.Prefix != "" {
+		v = r.Prefix + " " + v
+	}
+	return v, nil
+}
+
+func (r *HeaderRule) name() string {
+	if r.Name == "" {
+		return "Authorization"
+	}
+	return http.CanonicalHeaderKey(r.Name)
+}
+
+// matches reports whether r applies to u.
+func (r *HeaderRule) matches(u *url.URL) bool {
+	path := strings.TrimSuffix(u.Path, "/")
+	return module.MatchPrefixPatterns(r.Hosts, u.Host+path) ||
+		module.MatchPrefixPatterns(r.Hosts, u.Hostname()+path)
+}
+
+// Headers supplies the headers of the rules matching each request.
+// If several matching rules set the same header, the first one wins.
+type Headers []HeaderRule
+
+func (h Headers) Credentials(u *url.URL) (*Credentials, error) {
+	var header http.Header
+	for i := range h {
+		r := &h[i]
+		if !r.matches(u) || header.Get(r.name()) != "" {
+			continue
+		}
+		v, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		if v == "" {
+			continue
+		}
+		if header == nil {
+			header = make(http.Header)
+		}
+		header.Set(r.name(), v)
+	}
+	if header == nil {
+		return nil, nil
+	}
+	return &Credentials{Header: header}, nil
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	const name = "GO_GET_AUTH_TEST_HEADER"
+	defer os.Unsetenv(name)
+	dir, err := ioutil.TempDir("", "auth-header-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "token")
+	h := Headers{
+		{Hosts: "github.com/my-org", Env: name, Prefix: "Bearer"},
+		{Hosts: "*.example.com", Name: "private-token", File: file},
+		{Hosts: "gitlab.example.com", Name: "Private-Token", Env: name},
+	}
+
+	for _, s := range []string{"https://github.com/my-org/repo", "https://gitlab.example.com:8443/group/repo.git"} {
+		u, _ := url.Parse(s)
+		if c, err := h.Credentials(u); c != nil || err != nil {
+			t.Errorf("Credentials(%s) with no values = %v, %v; want nil, nil", s, c, err)
+		}
+	}
+
+	os.Setenv(name, "env-token")
+	if err := ioutil.WriteFile(file, []byte("  file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		url, name, want string
+	}{
+		{"https://github.com/my-org/repo", "Authorization", "Bearer env-token"},
+		{"https://github.com/other-org/repo", "Authorization", ""},
+		{"https://github.com/my-org-2", "Authorization", ""},
+		// The first matching rule for a header wins.
+		{"https://gitlab.example.com:8443/group/repo.git", "Private-Token", "file-token"},
+		{"https://example.com/", "Private-Token", ""},
+	} {
+		u, _ := url.Parse(tt.url)
+		c, err := h.Credentials(u)
+		if err != nil {
+			t.Fatalf("Credentials(%s): %v", tt.url, err)
+		}
+		got := ""
+		if c != nil {
+			got = c.Headers().Get(tt.name)
+		}
+		if got != tt.want {
+			t.Errorf("Credentials(%s) %s = %q; want %q", tt.url, tt.name, got, tt.want)
+		}
+	}
+
+	os.Setenv(name, "bad\nvalue")
+	u, _ := url.Parse("https://github.com/my-org/repo")
+	if _, err := h.Credentials(u); err == nil {
+		t.Errorf("Credentials with a newline in $%s succeeded; want error", name)
+	}
+}
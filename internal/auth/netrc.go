@@ -6,75 +6,276 @@ package auth
 
 import (
 	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 )
 
+// A netrcLine is an entry of a .netrc file. The default entry,
+// which matches any machine, has an empty machine.
 type netrcLine struct {
 	machine  string
 	login    string
 	password string
 }
 
-var (
-	netrcOnce sync.Once
-	netrc     []netrcLine
-	netrcErr  error
-)
+// Netrc supplies the credentials in a .netrc file.
+// The file is read again whenever it or its mode changes.
+//
+// A request is given the credentials of the first entry for its host
+// and port, or else of the first entry for its host that names no port,
+// or else, if UseDefault is set, of the default entry.
+type Netrc struct {
+	// Path is the file to read. If empty, it is $NETRC,
+	// or else .netrc (_netrc on Windows) in the user's home directory.
+	Path string
+
+	// UseDefault sends the credentials of the file's default entry to
+	// hosts that have no entry of their own. It is off by default, since
+	// import paths can send requests to any host.
+	UseDefault bool
+
+	// Warn, if non-nil, is told of problems with the file that don't
+	// stop it from being used, such as its being readable by others.
+	Warn func(msg string, keyvals ...interface{})
+
+	mu    sync.Mutex
+	path  string      // file lines was read from
+	mod   time.Time   // modification time of path when read
+	size  int64       // size of path when read
+	mode  os.FileMode // mode of path when read, for the readability warning
+	lines []netrcLine
+	gen   int // incremented whenever lines changes
+}
+
+func (n *Netrc) Credentials(u *url.URL) (*Credentials, error) {
+	lines, err := n.load()
+	if err != nil {
+		return nil, err
+	}
+	if l := matchNetrc(lines, u, n.UseDefault); l != nil {
+		return &Credentials{Username: l.login, Password: l.password}, nil
+	}
+	return nil, nil
+}
 
+// matchNetrc returns the entry of lines for a request to u, or nil.
+// The default entry is only returned if useDefault is set.
+func matchNetrc(lines []netrcLine, u *url.URL, useDefault bool) *netrcLine {
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https":
+			port = "443"
+		case "http":
+			port = "80"
+		}
+	}
+	var anyPort, def *netrcLine
+	for i := range lines {
+		l := &lines[i]
+		if l.machine == "" {
+			if def == nil && useDefault {
+				def = l
+			}
+			continue
+		}
+		mhost, mport := l.machine, ""
+		if h, p, err := net.SplitHostPort(l.machine); err == nil {
+			mhost, mport = h, p
+		}
+		if !strings.EqualFold(mhost, host) {
+			continue
+		}
+		if mport != "" && mport == port {
+			return l
+		}
+		if mport == "" && anyPort == nil {
+			anyPort = l
+		}
+	}
+	if anyPort != nil {
+		return anyPort
+	}
+	return def
+}
+
+// load returns the entries of the file, reading it again if it changed
+// since the last call.
+func (n *Netrc) load() ([]netrcLine, error) {
+	path := n.Path
+	if path == "" {
+		var err error
+		if path, err = netrcPath(); err != nil {
+			// No home directory, so no .netrc.
+			return nil, nil
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		if n.path != "" {
+			n.path, n.lines = "", nil
+			n.gen++
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if path == n.path && info.ModTime().Equal(n.mod) && info.Size() == n.size && info.Mode() == n.mode {
+		return n.lines, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	n.path, n.mod, n.size, n.mode = path, info.ModTime(), info.Size(), info.Mode()
+	if n.Warn != nil && runtime.GOOS != "windows" && info.Mode().Perm()&0004 != 0 {
+		n.Warn("netrc file is readable by other users; its passwords are exposed", "path", path)
+	}
+	n.lines = parseNetrc(string(data))
+	n.gen++
+	return n.lines, nil
+}
+
+// parseNetrc parses the entries of a .netrc file that have both
+// a login and a password.
 func parseNetrc(data string) []netrcLine {
 	// See https://www.gnu.org/software/inetutils/manual/html_node/The-_002enetrc-file.html
 	// for documentation on the .netrc format.
 	var nrc []netrcLine
-	var l netrcLine
-	inMacro := false
-	for _, line := range strings.Split(data, "\n") {
-		if inMacro {
-			if line == "" {
-				inMacro = false
+	var l *netrcLine
+	add := func() {
+		if l != nil && l.login != "" && l.password != "" {
+			nrc = append(nrc, *l)
+		}
+		l = nil
+	}
+	s := &netrcScanner{data: data}
+	for {
+		tok, ok := s.next()
+		if !ok {
+			break
+		}
+		// Reset at each "machine" token.
+		// “The auto-login process searches the .netrc file for a machine token
+		// that matches […]. Once a match is made, the subsequent .netrc tokens
+		// are processed, stopping when the end of file is reached or another
+		// machine or a default token is encountered.”
+		switch tok {
+		case "machine", "default":
+			if l != nil && l.machine == "" {
+				// “There can be only one default token, and it must be after all machine tokens.”
+				add()
+				return nrc
 			}
+			add()
+			l = &netrcLine{}
+			if tok == "machine" {
+				// An entry without a name matches nothing.
+				if l.machine, _ = s.next(); l.machine == "" {
+					l = nil
+				}
+			}
+			continue
+		case "macdef":
+			// “A macro is defined with the specified name; its contents begin with
+			// the next .netrc line and continue until a null line (consecutive
+			// new-line characters) is encountered.”
+			s.next()
+			s.inMacro = true
 			continue
 		}
+		val, _ := s.next()
+		if l == nil {
+			continue
+		}
+		switch tok {
+		case "login":
+			l.login = val
+		case "password":
+			l.password = val
+		}
+	}
+	add()
+	return nrc
+}
 
-		f := strings.Fields(line)
-		i := 0
-		for ; i < len(f)-1; i += 2 {
-			// Reset at each "machine" token.
-			// “The auto-login process searches the .netrc file for a machine token
-			// that matches […]. Once a match is made, the subsequent .netrc tokens
-			// are processed, stopping when the end of file is reached or another
-			// machine or a default token is encountered.”
-			switch f[i] {
-			case "machine":
-				l = netrcLine{machine: f[i+1]}
-			case "default":
-				break
-			case "login":
-				l.login = f[i+1]
-			case "password":
-				l.password = f[i+1]
-			case "macdef":
-				// “A macro is defined with the specified name; its contents begin with
-				// the next .netrc line and continue until a null line (consecutive
-				// new-line characters) is encountered.”
-				inMacro = true
-			}
-			if l.machine != "" && l.login != "" && l.password != "" {
-				nrc = append(nrc, l)
-				l = netrcLine{}
-			}
+// A netrcScanner splits a .netrc file into tokens, which are separated
+// by white space, including newlines. A token may be quoted with double
+// quotes to include white space, and a backslash escapes the character
+// after it, in or out of quotes.
+type netrcScanner struct {
+	data    string
+	pos     int
+	inMacro bool // skip the lines after the current one, up to an empty line
+}
+
+// next returns the next token, or false at the end of the file.
+func (s *netrcScanner) next() (string, bool) {
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		if c == '\n' && s.inMacro {
+			s.skipMacro()
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			break
 		}
+		s.pos++
+	}
+	if s.pos >= len(s.data) {
+		return "", false
+	}
 
-		if i < len(f) && f[i] == "default" {
-			// “There can be only one default token, and it must be after all machine tokens.”
+	var tok strings.Builder
+	quoted := s.data[s.pos] == '"'
+	if quoted {
+		s.pos++
+	}
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		if quoted && c == '"' {
+			s.pos++
+			break
+		}
+		if !quoted && (c == ' ' || c == '\t' || c == '\r' || c == '\n') {
 			break
 		}
+		if c == '\\' && s.pos+1 < len(s.data) {
+			s.pos++
+			c = s.data[s.pos]
+		}
+		tok.WriteByte(c)
+		s.pos++
 	}
+	return tok.String(), true
+}
 
-	return nrc
+// skipMacro skips the body of a macro definition, from the newline
+// ending the line that defines it through the next empty line.
+func (s *netrcScanner) skipMacro() {
+	s.inMacro = false
+	for s.pos < len(s.data) {
+		end := strings.IndexByte(s.data[s.pos+1:], '\n')
+		if end < 0 {
+			s.pos = len(s.data)
+			return
+		}
+		line := s.data[s.pos+1 : s.pos+1+end]
+		s.pos += 1 + end
+		if strings.TrimSuffix(line, "\r") == "" {
+			return
+		}
+	}
 }
 
 func netrcPath() (string, error) {
@@ -91,21 +292,3 @@ func netrcPath() (string, error) {
 	}
 	return filepath.Join(dir, base), nil
 }
-
-func readNetrc() {
-	path, err := netrcPath()
-	if err != nil {
-		netrcErr = err
-		return
-	}
-
-	data, err := ioutil.ReadFile(path)
-	if err != nil {
-		if !os.IsNotExist(err) {
-			netrcErr = err
-		}
-		return
-	}
-
-	netrc = parseNetrc(string(data))
-}
@@ -5,7 +5,12 @@
 package auth
 
 import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"testing"
 )
 
@@ -50,9 +55,112 @@ func TestParseNetrc(t *testing.T) {
 		{"test.host", "user2", "pwd2"},
 		{"oneline", "user3", "pwd3"},
 		{"hasmacro.too", "user4", "pwd4"},
+		{"", "anonymous", "gopher@golang.org"},
 	}
 
 	if !reflect.DeepEqual(lines, want) {
 		t.Errorf("parseNetrc:\nhave %q\nwant %q", lines, want)
 	}
 }
+
+func TestParseNetrcTokens(t *testing.T) {
+	lines := parseNetrc(`machine quoted login "the user" password "pass \"word\" \\ too"
+machine escaped login us\ er password p\\w account acct
+machine
+multi.line
+  login
+    user
+  password
+    pwd
+`)
+	want := []netrcLine{
+		{"quoted", "the user", `pass "word" \ too`},
+		{"escaped", "us er", `p\w`},
+		{"multi.line", "user", "pwd"},
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("parseNetrc:\nhave %q\nwant %q", lines, want)
+	}
+}
+
+func TestParseNetrcCRLF(t *testing.T) {
+	lines := parseNetrc("machine a macdef m\r\nlogin nobody\r\n\r\nmachine b login user password pwd\r\n")
+	want := []netrcLine{{"b", "user", "pwd"}}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("parseNetrc:\nhave %q\nwant %q", lines, want)
+	}
+}
+
+func TestMatchNetrc(t *testing.T) {
+	lines := parseNetrc(`
+machine example.com:8443 login port password p1
+machine Example.com login host password p2
+machine example.com:443 login tls password p3
+machine other.com login other password p4
+default login anonymous password guest
+`)
+	for _, tt := range []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com:8443/repo", "port"},
+		{"https://example.com:9443/repo", "host"},
+		{"https://EXAMPLE.COM/repo", "tls"},
+		{"http://example.com/repo", "host"},
+		{"https://other.com:8443/", "other"},
+		{"https://unknown.com/", "anonymous"},
+	} {
+		u, _ := url.Parse(tt.url)
+		l := matchNetrc(lines, u, true)
+		if l == nil || l.login != tt.want {
+			t.Errorf("matchNetrc(%s) = %v; want login %s", tt.url, l, tt.want)
+		}
+	}
+
+	unknown := &url.URL{Scheme: "https", Host: "unknown.com"}
+	if l := matchNetrc(lines[:4], unknown, true); l != nil {
+		t.Errorf("matchNetrc without default = %v; want nil", l)
+	}
+	if l := matchNetrc(lines, unknown, false); l != nil {
+		t.Errorf("matchNetrc with the default entry off = %v; want nil", l)
+	}
+}
+
+func TestNetrcWarnsWorldReadable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes don't apply on windows")
+	}
+	dir, err := ioutil.TempDir("", "auth-netrc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "netrc")
+	if err := ioutil.WriteFile(path, []byte("machine example.com login user password pwd\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var warnings []string
+	n := &Netrc{Path: path, Warn: func(msg string, keyvals ...interface{}) {
+		warnings = append(warnings, msg)
+	}}
+	u := &url.URL{Scheme: "https", Host: "example.com"}
+	if c, err := n.Credentials(u); err != nil || c == nil || c.Password != "pwd" {
+		t.Fatalf("Credentials = %v, %v; want the entry", c, err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings for a private file: %q", warnings)
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Changing the mode doesn't change the modification time or size,
+	// but is noticed all the same.
+	if c, err := n.Credentials(u); err != nil || c == nil {
+		t.Fatalf("Credentials = %v, %v; want the entry", c, err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings for a world-readable file: %q; want one", warnings)
+	}
+}
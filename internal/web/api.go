@@ -19,6 +19,8 @@ import (
 	"strings"
 	"unicode"
 	"unicode/utf8"
+
+	"github.com/tilt-dev/go-get/internal/auth"
 )
 
 // SecurityMode specifies whether a function should make network
@@ -32,6 +34,25 @@ const (
 	Insecure                            // Allow plain HTTP if not explicitly HTTPS; skip HTTPS validation.
 )
 
+// A Client fetches resources on behalf of one user of this package.
+// The zero Client is usable.
+type Client struct {
+	// Credentials, if non-nil, is consulted for every HTTPS request.
+	// If nil, auth.Default is.
+	Credentials auth.Provider
+
+	// Config, if non-nil, configures the client's connections.
+	// Redirects from HTTPS to plain HTTP are refused regardless.
+	Config *Config
+
+	// Cache, if non-nil, keeps responses on disk for reuse, and for
+	// use when the server can't be reached.
+	Cache *Cache
+}
+
+// DefaultClient is the Client used by the package-level functions.
+var DefaultClient = &Client{}
+
 // An HTTPError describes an HTTP error response (non-200 result).
 type HTTPError struct {
 	URL        string // redacted
@@ -79,7 +100,12 @@ func (e *HTTPError) Unwrap() error {
 //
 // GetBytes is a convenience wrapper around Get and Response.Err.
 func GetBytes(u *url.URL) ([]byte, error) {
-	resp, err := Get(DefaultSecurity, u)
+	return DefaultClient.GetBytes(u)
+}
+
+// GetBytes is like the package-level GetBytes, but uses c.
+func (c *Client) GetBytes(u *url.URL) ([]byte, error) {
+	resp, err := c.Get(DefaultSecurity, u)
 	if err != nil {
 		return nil, err
 	}
@@ -173,14 +199,20 @@ func (r *Response) formatErrorDetail() string {
 // and it is a redacted URL suitable for use in error messages.
 //
 // For the "https" scheme only, credentials are attached using the
-// cmd/go/internal/auth package. If the URL itself includes a username and
+// internal/auth package. If the URL itself includes a username and
 // password, it will not be attempted under the "http" scheme unless the
 // security mode is Insecure.
 //
 // Get returns a non-nil error only if the request did not receive a response
 // under any applicable scheme. (A non-2xx response does not cause an error.)
 func Get(security SecurityMode, u *url.URL) (*Response, error) {
-	return get(security, u)
+	return DefaultClient.Get(security, u)
+}
+
+// Get is like the package-level Get, but uses c, attaching the
+// credentials from c.Credentials.
+func (c *Client) Get(security SecurityMode, u *url.URL) (*Response, error) {
+	return c.get(security, u)
 }
 
 // Redacted returns a redacted string form of the URL,
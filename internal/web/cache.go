@@ -0,0 +1,260 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Cache keeps the successful responses of a Client on disk, so that
+// repeated requests for a resource can be answered without the network.
+//
+// A response is reused without asking the server while its Cache-Control
+// max-age or its Expires header says it is fresh. After that it is
+// revalidated with a conditional request, using its ETag and
+// Last-Modified headers. If the server can't be reached, a stale
+// response is used anyway, for up to MaxStale. Responses marked
+// no-store or private are not kept, and those marked no-cache are
+// revalidated every time.
+//
+// The cache may be shared by several users, so a Client doesn't use it
+// for requests that carry credentials.
+type Cache struct {
+	// Dir is the directory holding the responses, one file per URL.
+	Dir string
+
+	// MaxStale is how long after it was received or last revalidated
+	// a response may stand in for one the server can't be reached for.
+	// Defaults to a week.
+	MaxStale time.Duration
+
+	// Warn, if non-nil, is told when a stale response is used.
+	Warn func(msg string, keyvals ...interface{})
+
+	now func() time.Time // for tests; defaults to time.Now
+}
+
+// defaultMaxStale is the MaxStale of a Cache that doesn't set it.
+const defaultMaxStale = 7 * 24 * time.Hour
+
+// A cacheEntry is a response as stored in a Cache.
+type cacheEntry struct {
+	URL    string
+	Status string
+	Header http.Header
+	Body   []byte
+	Stored time.Time // when the response was received or last revalidated
+}
+
+func (c *Cache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// path returns the file for the response to url.
+func (c *Cache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load returns the entry for url, or nil if there is none.
+// A corrupt entry is treated as missing.
+func (c *Cache) load(url string) *cacheEntry {
+	data, err := ioutil.ReadFile(c.path(url))
+	if err != nil {
+		return nil
+	}
+	e := new(cacheEntry)
+	if err := json.Unmarshal(data, e); err != nil || e.URL != url {
+		return nil
+	}
+	return e
+}
+
+// store saves e, replacing any entry for its URL.
+func (c *Cache) store(e *cacheEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(c.Dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.path(e.URL))
+}
+
+// do sends req with send, answering it from the cache when it can,
+// and stores the response if it may be reused.
+func (c *Cache) do(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	url := req.URL.String()
+	e := c.load(url)
+	now := c.clock()
+	if e != nil && e.fresh(now) {
+		return e.response(req), nil
+	}
+	if e != nil {
+		if etag := e.Header.Get("Etag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lm := e.Header.Get("Last-Modified"); lm != "" {
+			req.Header.Set("If-Modified-Since", lm)
+		}
+	}
+
+	res, err := send(req)
+	if err != nil {
+		// If the server can't be reached, a stale response is better
+		// than none. Other errors, such as a bad certificate or a
+		// refused redirect, are the server's answer.
+		if e != nil && unreachable(err) && now.Sub(e.Stored) < c.maxStale() {
+			if c.Warn != nil {
+				c.Warn("using stale cached response", "url", Redacted(req.URL), "age", now.Sub(e.Stored).Round(time.Second), "err", err)
+			}
+			return e.response(req), nil
+		}
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotModified && e != nil {
+		res.Body.Close()
+		for k, vs := range res.Header {
+			e.Header[k] = vs
+		}
+		e.Stored = now
+		// A failure to save only costs a later revalidation.
+		_ = c.store(e)
+		return e.response(req), nil
+	}
+
+	if !cacheable(res) {
+		return res, nil
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	_ = c.store(&cacheEntry{
+		URL:    url,
+		Status: res.Status,
+		Header: res.Header,
+		Body:   body,
+		Stored: now,
+	})
+	return res, nil
+}
+
+func (c *Cache) maxStale() time.Duration {
+	if c.MaxStale > 0 {
+		return c.MaxStale
+	}
+	return defaultMaxStale
+}
+
+// unreachable reports whether err, from sending a request, means that
+// the server couldn't be reached at all.
+func unreachable(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// cacheable reports whether res may be stored.
+func cacheable(res *http.Response) bool {
+	if res.StatusCode != http.StatusOK {
+		return false
+	}
+	cc := cacheControl(res.Header)
+	if _, ok := cc["no-store"]; ok {
+		return false
+	}
+	if _, ok := cc["private"]; ok {
+		return false
+	}
+	return res.Header.Get("Vary") != "*"
+}
+
+// fresh reports whether e may be used at now without revalidation.
+func (e *cacheEntry) fresh(now time.Time) bool {
+	cc := cacheControl(e.Header)
+	if _, ok := cc["no-cache"]; ok {
+		return false
+	}
+	if v, ok := cc["max-age"]; ok {
+		secs, err := strconv.ParseInt(v, 10, 64)
+		return err == nil && now.Sub(e.Stored) < time.Duration(secs)*time.Second
+	}
+	if exp := e.Header.Get("Expires"); exp != "" {
+		t, err := http.ParseTime(exp)
+		return err == nil && now.Before(t)
+	}
+	return false
+}
+
+// response returns e as a response to req.
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        e.Status,
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// cacheControl parses the Cache-Control directives of h,
+// with names in lower case.
+func cacheControl(h http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, line := range h["Cache-Control"] {
+		for _, d := range strings.Split(line, ",") {
+			d = strings.TrimSpace(d)
+			if d == "" {
+				continue
+			}
+			name, value := d, ""
+			if i := strings.Index(d, "="); i >= 0 {
+				name, value = d[:i], strings.Trim(d[i+1:], `"`)
+			}
+			cc[strings.ToLower(strings.TrimSpace(name))] = value
+		}
+	}
+	return cc
+}
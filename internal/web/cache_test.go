@@ -0,0 +1,294 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tilt-dev/go-get/internal/auth"
+)
+
+// newCacheClient returns a client caching in a new directory, whose
+// clock reads *now, and a func removing the directory.
+func newCacheClient(t *testing.T, now *time.Time) (*Client, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "web-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{Cache: &Cache{Dir: dir, now: func() time.Time { return *now }}}
+	return c, func() { os.RemoveAll(dir) }
+}
+
+func TestCacheFresh(t *testing.T) {
+	now := time.Now()
+	c, cleanup := newCacheClient(t, &now)
+	defer cleanup()
+
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		fmt.Fprintf(w, "body %d", hits)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/meta")
+
+	for i, want := range []string{"body 1", "body 1"} {
+		data, err := c.GetBytes(u)
+		if err != nil || string(data) != want {
+			t.Fatalf("GetBytes #%d = %q, %v; want %q, nil", i+1, data, err, want)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("server saw %d requests; want 1", hits)
+	}
+
+	// Once max-age has passed, the response is fetched again.
+	now = now.Add(2 * time.Minute)
+	if data, err := c.GetBytes(u); err != nil || string(data) != "body 2" {
+		t.Errorf("GetBytes after max-age = %q, %v; want %q, nil", data, err, "body 2")
+	}
+}
+
+func TestCacheRevalidate(t *testing.T) {
+	now := time.Now()
+	c, cleanup := newCacheClient(t, &now)
+	defer cleanup()
+
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	var gotETag, gotSince []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotETag = append(gotETag, r.Header.Get("If-None-Match"))
+		gotSince = append(gotSince, r.Header.Get("If-Modified-Since"))
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.URL.Path == "/etag" {
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		} else {
+			w.Header().Set("Last-Modified", lastModified)
+			if r.Header.Get("If-Modified-Since") == lastModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		fmt.Fprint(w, "content")
+	}))
+	defer srv.Close()
+
+	for _, path := range []string{"/etag", "/modified"} {
+		gotETag, gotSince = nil, nil
+		u, _ := url.Parse(srv.URL + path)
+		for i := 0; i < 2; i++ {
+			data, err := c.GetBytes(u)
+			if err != nil || string(data) != "content" {
+				t.Fatalf("%s: GetBytes #%d = %q, %v; want %q, nil", path, i+1, data, err, "content")
+			}
+		}
+		if len(gotETag) != 2 {
+			t.Fatalf("%s: server saw %d requests; want 2", path, len(gotETag))
+		}
+		if gotETag[0] != "" || gotSince[0] != "" {
+			t.Errorf("%s: first request is conditional: %q, %q", path, gotETag[0], gotSince[0])
+		}
+		if path == "/etag" && gotETag[1] != `"v1"` {
+			t.Errorf("%s: If-None-Match = %q; want %q", path, gotETag[1], `"v1"`)
+		}
+		if path == "/modified" && gotSince[1] != lastModified {
+			t.Errorf("%s: If-Modified-Since = %q; want %q", path, gotSince[1], lastModified)
+		}
+	}
+}
+
+func TestCacheStaleWhenDown(t *testing.T) {
+	now := time.Now()
+	c, cleanup := newCacheClient(t, &now)
+	defer cleanup()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=10")
+		fmt.Fprint(w, "content")
+	}))
+	u, _ := url.Parse(srv.URL + "/meta")
+	if _, err := c.GetBytes(u); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	now = now.Add(time.Hour)
+	if data, err := c.GetBytes(u); err != nil || string(data) != "content" {
+		t.Errorf("GetBytes with the server down = %q, %v; want %q, nil", data, err, "content")
+	}
+	other, _ := url.Parse(srv.URL + "/other")
+	if _, err := c.GetBytes(other); err == nil {
+		t.Errorf("GetBytes of an uncached URL with the server down succeeded")
+	}
+}
+
+func TestCacheNotStored(t *testing.T) {
+	now := time.Now()
+	c, cleanup := newCacheClient(t, &now)
+	defer cleanup()
+
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		switch r.URL.Path {
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store, max-age=60")
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "*")
+		case "/missing":
+			w.Header().Set("Cache-Control", "max-age=60")
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "content")
+	}))
+	defer srv.Close()
+
+	for _, path := range []string{"/no-store", "/private", "/vary", "/missing"} {
+		hits = 0
+		u, _ := url.Parse(srv.URL + path)
+		c.GetBytes(u)
+		c.GetBytes(u)
+		if hits != 2 {
+			t.Errorf("%s: server saw %d requests; want 2", path, hits)
+		}
+	}
+	files, err := ioutil.ReadDir(c.Cache.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("cache holds %d files; want none", len(files))
+	}
+}
+
+func TestCacheFreshness(t *testing.T) {
+	stored := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		header http.Header
+		after  time.Duration
+		fresh  bool
+	}{
+		{http.Header{"Cache-Control": {"max-age=60"}}, 30 * time.Second, true},
+		{http.Header{"Cache-Control": {"max-age=60"}}, 90 * time.Second, false},
+		{http.Header{"Cache-Control": {`Max-Age="60"`}}, 30 * time.Second, true},
+		{http.Header{"Cache-Control": {"max-age=60, no-cache"}}, 0, false},
+		{http.Header{"Cache-Control": {"max-age=bad"}}, 0, false},
+		{http.Header{"Expires": {"Wed, 01 Jan 2020 01:00:00 GMT"}}, 30 * time.Minute, true},
+		{http.Header{"Expires": {"Wed, 01 Jan 2020 01:00:00 GMT"}}, 2 * time.Hour, false},
+		{http.Header{"Cache-Control": {"max-age=0"}, "Expires": {"Wed, 01 Jan 2020 01:00:00 GMT"}}, 0, false},
+		{http.Header{}, 0, false},
+	} {
+		e := &cacheEntry{Header: tt.header, Stored: stored}
+		if fresh := e.fresh(stored.Add(tt.after)); fresh != tt.fresh {
+			t.Errorf("fresh(%v) after %v = %v; want %v", tt.header, tt.after, fresh, tt.fresh)
+		}
+	}
+}
+
+func TestCacheStaleOnlyWhenUnreachable(t *testing.T) {
+	now := time.Now()
+	c, cleanup := newCacheClient(t, &now)
+	defer cleanup()
+	var warnings []string
+	c.Cache.Warn = func(msg string, keyvals ...interface{}) {
+		warnings = append(warnings, msg)
+	}
+
+	var sendErr error
+	c.Config = &Config{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if sendErr != nil {
+			return nil, sendErr
+		}
+		return &http.Response{
+			Status:     "200 OK",
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Cache-Control": {"max-age=10"}},
+			Body:       ioutil.NopCloser(strings.NewReader("content")),
+			Request:    req,
+		}, nil
+	})}
+	u := &url.URL{Scheme: "https", Host: "example.com", Path: "/meta"}
+	if _, err := c.GetBytes(u); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour)
+
+	sendErr = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	if data, err := c.GetBytes(u); err != nil || string(data) != "content" {
+		t.Errorf("GetBytes with the server down = %q, %v; want %q, nil", data, err, "content")
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings = %q; want one", warnings)
+	}
+
+	// A server that answers, if only with a bad certificate, gets no stale
+	// response in its place.
+	sendErr = errors.New("x509: certificate signed by unknown authority")
+	if _, err := c.GetBytes(u); err == nil {
+		t.Errorf("GetBytes with a certificate error succeeded")
+	}
+
+	// Nor does one that has been down for longer than MaxStale.
+	sendErr = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	now = now.Add(defaultMaxStale)
+	if _, err := c.GetBytes(u); err == nil {
+		t.Errorf("GetBytes with an entry older than MaxStale succeeded")
+	}
+}
+
+func TestCacheSkipsCredentials(t *testing.T) {
+	now := time.Now()
+	c, cleanup := newCacheClient(t, &now)
+	defer cleanup()
+
+	var tokens []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, r.Header.Get("Private-Token"))
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, "for "+r.Header.Get("Private-Token"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/meta")
+	c.Config = &Config{Transport: srv.Client().Transport}
+	c.Credentials = auth.Static{u.Host: {Header: http.Header{"Private-Token": {"tok"}}}}
+
+	for i := 0; i < 2; i++ {
+		if data, err := c.GetBytes(u); err != nil || string(data) != "for tok" {
+			t.Fatalf("GetBytes = %q, %v; want %q, nil", data, err, "for tok")
+		}
+	}
+	if len(tokens) != 2 {
+		t.Errorf("server saw %d requests; want 2", len(tokens))
+	}
+	files, err := ioutil.ReadDir(c.Cache.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("cache holds %d files; want none", len(files))
+	}
+
+	// Without credentials, the response isn't the one sent with them.
+	c.Credentials = auth.Static{}
+	if data, err := c.GetBytes(u); err != nil || string(data) != "for " {
+		t.Errorf("GetBytes without credentials = %q, %v; want %q, nil", data, err, "for ")
+	}
+}
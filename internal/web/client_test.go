@@ -0,0 +1,201 @@
+package web
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tilt-dev/go-get/internal/auth"
+)
+
+func TestClientCredentials(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{Credentials: auth.Static{}}
+	resp, err := c.Get(Insecure, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("without credentials: status %d; want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	c.Credentials = auth.Static{u.Host: {Username: "alice", Password: "secret"}}
+	resp, err = c.Get(Insecure, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("with credentials: status %d; want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestClientReportsCredentials(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir, err := ioutil.TempDir("", "web-TestClientReportsCredentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	log := filepath.Join(dir, "log")
+	helper := filepath.Join(dir, "helper")
+	script := "#!/bin/sh\ncat >/dev/null\necho $1 >> '" + log + "'\n" +
+		"[ $1 = get ] && echo username=alice && echo password=secret\nexit 0\n"
+	if err := ioutil.WriteFile(helper, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		"HOME":                dir,
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"GIT_CONFIG_COUNT":    "1",
+		"GIT_CONFIG_KEY_0":    "credential.helper",
+		"GIT_CONFIG_VALUE_0":  helper,
+	} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+
+	status := http.StatusOK
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{Credentials: &auth.GitHelper{}}
+	for _, status = range []int{http.StatusOK, http.StatusOK, http.StatusNotFound, http.StatusUnauthorized} {
+		resp, err := c.Get(Insecure, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	data, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first 200 stores the credentials, later ones and 404 say
+	// nothing about them, and 401 erases them.
+	if got, want := strings.Fields(string(data)), []string{"get", "store", "erase"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("helper calls = %q; want %q", got, want)
+	}
+}
+
+func TestClientRetriesWithGOAUTH(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	dir, err := ioutil.TempDir("", "web-TestClientRetriesWithGOAUTH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The command only has a token once it is given a URL.
+	script := filepath.Join(dir, "auth")
+	err = ioutil.WriteFile(script, []byte("#!/bin/sh\n[ -n \"$1\" ] && printf '%s\\n\\nAuthorization: Bearer good\\n\\n' \"$1\"\nexit 0\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var auths []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL + "/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{Credentials: &auth.GoAuth{Setting: script}}
+	resp, err := c.Get(Insecure, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d; want %d", resp.StatusCode, http.StatusOK)
+	}
+	if want := []string{"", "Bearer good"}; !reflect.DeepEqual(auths, want) {
+		t.Errorf("requests had Authorization %q; want %q", auths, want)
+	}
+}
+
+func TestClientRedirectDropsCredentials(t *testing.T) {
+	var got []string
+	other := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, "other:"+r.Header.Get("Private-Token")+":"+r.Header.Get("Authorization"))
+	}))
+	defer other.Close()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.URL.Path+":"+r.Header.Get("Private-Token")+":"+r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/same":
+			http.Redirect(w, r, "/target", http.StatusFound)
+		case "/elsewhere":
+			http.Redirect(w, r, other.URL+"/target", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := &auth.Credentials{Username: "alice", Password: "secret", Header: http.Header{"Private-Token": {"tok"}}}
+	basic := "Basic YWxpY2U6c2VjcmV0"
+
+	for _, c := range []*Client{
+		{Credentials: auth.Static{u.Host: creds}},
+		{Credentials: auth.Static{u.Host: creds}, Config: &Config{Transport: other.Client().Transport}},
+	} {
+		for _, security := range []SecurityMode{Insecure, SecureOnly} {
+			if c.Config == nil && security == SecureOnly {
+				continue // the test servers' certificate isn't trusted
+			}
+			got = nil
+			for _, path := range []string{"/same", "/elsewhere"} {
+				resp, err := c.Get(security, &url.URL{Scheme: "https", Host: u.Host, Path: path})
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+			}
+			want := []string{
+				"/same:tok:" + basic,
+				"/target:tok:" + basic,
+				"/elsewhere:tok:" + basic,
+				"other::",
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("requests = %q; want %q", got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// A Config configures the HTTP connections of a Client.
+// A Config must not be modified after its first use.
+type Config struct {
+	// CAFile is a file of PEM certificates to trust instead of the
+	// system's, as for git's http.sslCAInfo.
+	CAFile string
+
+	// RootCAs, if non-nil, are trusted too, or instead of the
+	// system's if CAFile is empty.
+	RootCAs *x509.CertPool
+
+	// CertFile and KeyFile are the PEM client certificate and key to
+	// present to servers that ask for one, as for git's http.sslCert
+	// and http.sslKey.
+	CertFile string
+	KeyFile  string
+
+	// ProxyURL is the proxy to send every request through.
+	ProxyURL string
+
+	// Proxy, if non-nil, chooses the proxy for each request instead,
+	// as http.Transport's Proxy does. If both are empty, the proxy is
+	// taken from the environment, as by http.ProxyFromEnvironment.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// Timeout limits the time a request may take, including reading
+	// the response body. Zero means no limit.
+	Timeout time.Duration
+
+	// UserAgent, if non-empty, is sent as the User-Agent header.
+	UserAgent string
+
+	// Transport, if non-nil, makes the requests, such as a test
+	// RoundTripper. The TLS and proxy settings above are then ignored.
+	Transport http.RoundTripper
+
+	once             sync.Once
+	secure, insecure *http.Client
+	err              error
+}
+
+// clients returns the clients for secure requests and for requests in
+// Insecure mode, built on first use.
+func (c *Config) clients() (secure, insecure *http.Client, err error) {
+	c.once.Do(func() {
+		var transport, insecureTransport http.RoundTripper
+		if c.Transport != nil {
+			transport, insecureTransport = c.Transport, c.Transport
+		} else {
+			var t *http.Transport
+			t, c.err = c.transport()
+			if c.err != nil {
+				return
+			}
+			it := t.Clone()
+			it.TLSClientConfig.InsecureSkipVerify = true
+			transport, insecureTransport = t, it
+		}
+		c.secure = &http.Client{
+			Transport:     transport,
+			Timeout:       c.Timeout,
+			CheckRedirect: securityPreservingHTTPClient.CheckRedirect,
+		}
+		// As impatientInsecureHTTPClient, fail quickly when connecting
+		// to https servers that might not be there.
+		timeout := impatientInsecureHTTPClient.Timeout
+		if c.Timeout > 0 && c.Timeout < timeout {
+			timeout = c.Timeout
+		}
+		c.insecure = &http.Client{
+			Transport:     insecureTransport,
+			Timeout:       timeout,
+			CheckRedirect: impatientInsecureHTTPClient.CheckRedirect,
+		}
+	})
+	return c.secure, c.insecure, c.err
+}
+
+// transport returns a transport with c's TLS and proxy settings.
+func (c *Config) transport() (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{RootCAs: c.RootCAs}
+	if c.CAFile != "" {
+		data, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %v", err)
+		}
+		pool := c.RootCAs
+		if pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("reading CA file %s: no certificates found", c.CAFile)
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("client certificate needs both CertFile and KeyFile")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %v", err)
+		}
+		t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	switch {
+	case c.Proxy != nil:
+		t.Proxy = c.Proxy
+	case c.ProxyURL != "":
+		u, err := url.Parse(c.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing proxy URL: %v", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	return t, nil
+}
@@ -0,0 +1,175 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCAFile writes the certificate of srv to a PEM file in dir.
+func writeCAFile(t *testing.T, dir string, srv *httptest.Server) string {
+	t.Helper()
+	file := filepath.Join(dir, "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// writeClientCert writes a self-signed client certificate and its key
+// to PEM files in dir.
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestConfigTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web-TestConfigTLS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var gotAgent, gotClient string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAgent = r.UserAgent()
+		if len(r.TLS.PeerCertificates) > 0 {
+			gotClient = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server's certificate isn't trusted by default.
+	if _, err := (&Client{Config: &Config{}}).Get(SecureOnly, u); err == nil {
+		t.Fatalf("Get with an untrusted certificate succeeded")
+	}
+
+	certFile, keyFile := writeClientCert(t, dir)
+	c := &Client{Config: &Config{
+		CAFile:    writeCAFile(t, dir, srv),
+		CertFile:  certFile,
+		KeyFile:   keyFile,
+		UserAgent: "go-get-test/1.0",
+	}}
+	resp, err := c.Get(SecureOnly, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if gotAgent != "go-get-test/1.0" {
+		t.Errorf("User-Agent = %q; want %q", gotAgent, "go-get-test/1.0")
+	}
+	if gotClient != "client" {
+		t.Errorf("client certificate = %q; want %q", gotClient, "client")
+	}
+
+	c = &Client{Config: &Config{CAFile: filepath.Join(dir, "client.key")}}
+	if _, err := c.Get(SecureOnly, u); err == nil || !strings.Contains(err.Error(), "no certificates found") {
+		t.Errorf("Get with a CA file without certificates: %v; want error", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestConfigTransport(t *testing.T) {
+	var got []string
+	c := &Client{Config: &Config{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		got = append(got, req.URL.String())
+		if req.URL.Scheme == "https" && req.URL.Path == "/redirect" {
+			return &http.Response{
+				StatusCode: http.StatusFound,
+				Header:     http.Header{"Location": {"http://example.com/plain"}},
+				Body:       http.NoBody,
+				Request:    req,
+			}, nil
+		}
+		return &http.Response{
+			Status:     "200 OK",
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader("hello")),
+			Request:    req,
+		}, nil
+	})}}
+
+	data, err := c.GetBytes(&url.URL{Scheme: "https", Host: "example.com", Path: "/file"})
+	if err != nil || string(data) != "hello" {
+		t.Errorf("GetBytes = %q, %v; want %q, nil", data, err, "hello")
+	}
+
+	// Redirects from HTTPS to HTTP are still refused.
+	_, err = c.GetBytes(&url.URL{Scheme: "https", Host: "example.com", Path: "/redirect"})
+	if err == nil || !strings.Contains(err.Error(), "redirected from secure URL") {
+		t.Errorf("GetBytes with a redirect to HTTP: %v; want error", err)
+	}
+	want := []string{"https://example.com/file", "https://example.com/redirect"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("requests = %q; want %q", got, want)
+	}
+}
+
+func TestConfigProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	c := &Client{Config: &Config{ProxyURL: proxy.URL}}
+	if _, err := c.GetBytes(&url.URL{Scheme: "http", Host: "example.invalid", Path: "/file"}); err != nil {
+		t.Fatal(err)
+	}
+	if proxied != "http://example.invalid/file" {
+		t.Errorf("proxy got request for %q; want %q", proxied, "http://example.invalid/file")
+	}
+}
@@ -13,6 +13,7 @@ package web
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"mime"
 	"net/http"
@@ -35,6 +36,14 @@ var impatientInsecureHTTPClient = &http.Client{
 			InsecureSkipVerify: true,
 		},
 	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		// As the default policy does.
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		dropCrossHostHeaders(req, via)
+		return nil
+	},
 }
 
 // securityPreservingHTTPClient is like the default HTTP client, but rejects
@@ -45,29 +54,96 @@ var securityPreservingHTTPClient = &http.Client{
 			lastHop := via[len(via)-1].URL
 			return fmt.Errorf("redirected from secure URL %s to insecure URL %s", lastHop, req.URL)
 		}
+		dropCrossHostHeaders(req, via)
 		return nil
 	},
 }
 
-func get(security SecurityMode, url *urlpkg.URL) (*Response, error) {
+// dropCrossHostHeaders removes the headers of req, a redirect, other than
+// the User-Agent if it goes to another host than the original request.
+// net/http copies every header onto redirects except Authorization and
+// cookies, but credentials may be in any header, such as PRIVATE-TOKEN.
+func dropCrossHostHeaders(req *http.Request, via []*http.Request) {
+	if len(via) == 0 || req.URL.Host == via[0].URL.Host {
+		return
+	}
+	for k := range req.Header {
+		if k != "User-Agent" {
+			delete(req.Header, k)
+		}
+	}
+}
+
+func (c *Client) get(security SecurityMode, url *urlpkg.URL) (*Response, error) {
 	if url.Scheme == "file" {
 		return getFile(url)
 	}
 
+	secure, insecure := securityPreservingHTTPClient, impatientInsecureHTTPClient
+	if c.Config != nil {
+		var err error
+		if secure, insecure, err = c.Config.clients(); err != nil {
+			return nil, err
+		}
+	}
+	send := func(req *http.Request) (*http.Response, error) {
+		if c.Config != nil && c.Config.UserAgent != "" {
+			req.Header.Set("User-Agent", c.Config.UserAgent)
+		}
+		if security == Insecure && req.URL.Scheme == "https" { // fail earlier
+			return insecure.Do(req)
+		}
+		return secure.Do(req)
+	}
+	do := func(req *http.Request, creds *auth.Credentials) (*http.Response, error) {
+		// Responses fetched without verifying the server's certificate
+		// aren't worth keeping, and those to requests with credentials
+		// are the user's alone, while the cache is shared.
+		if c.Cache == nil || security == Insecure || creds != nil {
+			return send(req)
+		}
+		return c.Cache.do(req, send)
+	}
+
 	fetch := func(url *urlpkg.URL) (*urlpkg.URL, *http.Response, error) {
 		req, err := http.NewRequest("GET", url.String(), nil)
 		if err != nil {
 			return nil, nil, err
 		}
+		var creds *auth.Credentials
 		if url.Scheme == "https" {
-			auth.AddCredentials(req)
+			creds, err = auth.AddCredentials(c.Credentials, req)
+			if err != nil {
+				return nil, nil, fmt.Errorf("credentials for %s: %v", Redacted(url), err)
+			}
 		}
 
-		var res *http.Response
-		if security == Insecure && url.Scheme == "https" { // fail earlier
-			res, err = impatientInsecureHTTPClient.Do(req)
-		} else {
-			res, err = securityPreservingHTTPClient.Do(req)
+		res, err := do(req, creds)
+		if err == nil {
+			reportCredentials(creds, res)
+		}
+		// If the request fails with a 4xx client error, retry it with
+		// credentials refreshed given the response, as GOAUTH does.
+		if url.Scheme == "https" && err == nil && res.StatusCode >= 400 && res.StatusCode < 500 {
+			req, err = http.NewRequest("GET", url.String(), nil)
+			if err != nil {
+				res.Body.Close()
+				return nil, nil, err
+			}
+			creds, err = auth.RetryCredentials(c.Credentials, req, res)
+			if err != nil {
+				res.Body.Close()
+				return nil, nil, fmt.Errorf("credentials for %s: %v", Redacted(url), err)
+			}
+			if creds != nil {
+				// Close the body of the previous response since we
+				// are discarding it and creating a new one.
+				res.Body.Close()
+				res, err = do(req, creds)
+				if err == nil {
+					reportCredentials(creds, res)
+				}
+			}
 		}
 		return url, res, err
 	}
@@ -145,6 +221,20 @@ func get(security SecurityMode, url *urlpkg.URL) (*Response, error) {
 	return r, nil
 }
 
+// reportCredentials tells the source of creds, if any, whether the
+// server accepted them, as shown by res.
+func reportCredentials(creds *auth.Credentials, res *http.Response) {
+	if creds == nil {
+		return
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		creds.Approve()
+	case http.StatusUnauthorized, http.StatusForbidden:
+		creds.Reject()
+	}
+}
+
 func getFile(u *urlpkg.URL) (*Response, error) {
 	path, err := urlToFilePath(u)
 	if err != nil {
@@ -0,0 +1,282 @@
+package get
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A Lock records exactly what was installed for a set of packages,
+// so that the same content can be installed again elsewhere.
+type Lock struct {
+	Packages []LockedPackage `json:"packages"`
+}
+
+// A LockedPackage records how one package was installed.
+type LockedPackage struct {
+	ImportPath string `json:"importPath"`
+	Repo       string `json:"repo"`            // repository URL, including scheme
+	VCS        string `json:"vcs"`             // vcs command ("git", "hg", ...)
+	Root       string `json:"root"`            // import path of the repository root
+	Query      string `json:"query,omitempty"` // ref passed to RefSync, if any
+	Revision   string `json:"revision"`        // exact revision checked out
+	Hash       string `json:"hash"`            // h1: hash of the package directory
+}
+
+// WriteLock records the current checkouts of pkgs in a lockfile at path.
+//
+// The packages must already have been downloaded. The query recorded for
+// each package is the last ref it was synced to with RefSync, by any
+// Downloader on the same source root, unless it was downloaded again or
+// checked out at another revision since.
+func (d *Downloader) WriteLock(path string, pkgs []string) error {
+	var lock Lock
+	for _, pkg := range pkgs {
+		lp, err := d.lockPackage(pkg)
+		if err != nil {
+			return err
+		}
+		lock.Packages = append(lock.Packages, *lp)
+	}
+
+	data, err := json.MarshalIndent(lock, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func (d *Downloader) lockPackage(pkg string) (_ *LockedPackage, err error) {
+	defer wrapError(pkg, &err)
+
+	pkg, rr, err := d.repoRoot(pkg)
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Join(d.srcRoot, filepath.FromSlash(rr.Root))
+	rev, err := rr.vcs.revision(d.toCmdContext(pkg, root), root)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := HashDir(d.DestinationPath(pkg), "")
+	if err != nil {
+		return nil, err
+	}
+	return &LockedPackage{
+		ImportPath: pkg,
+		Repo:       rr.Repo,
+		VCS:        rr.VCS,
+		Root:       rr.Root,
+		Query:      d.query(rr.Root, rev),
+		Revision:   rev,
+		Hash:       hash,
+	}, nil
+}
+
+// InstallFromLock checks out exactly the revisions recorded in the
+// lockfile at path, downloading the repositories as needed.
+//
+// It fails with ErrRefNotFound if a remote no longer has a recorded
+// revision, with ErrChecksumMismatch if the content of a package
+// differs from the recorded hash, and with ErrStaleCheckout if an
+// existing checkout was cloned from another repository than the
+// recorded one. A checkout that fails its checks is rolled back
+// as for Downloader.Signatures.
+func (d *Downloader) InstallFromLock(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var lock Lock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return fmt.Errorf("parsing %s: %v", path, err)
+	}
+	for _, lp := range lock.Packages {
+		if err := d.installLocked(lp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Downloader) installLocked(lp LockedPackage) (err error) {
+	defer wrapError(lp.ImportPath, &err)
+
+	vcs := vcsByCmd(lp.VCS)
+	if vcs == nil {
+		return fmt.Errorf("unknown version control system %q", lp.VCS)
+	}
+	if vcs.hasRevisionCmd == "" || vcs.tagSyncCmd == nil {
+		return fmt.Errorf("installing from a lock is not supported for %s", vcs.name)
+	}
+	if err := checkImportPath(lp.Root); err != nil {
+		return err
+	}
+	if lp.ImportPath != lp.Root && !strings.HasPrefix(lp.ImportPath, lp.Root+"/") {
+		return fmt.Errorf("import path %s is not inside repository root %s", lp.ImportPath, lp.Root)
+	}
+	if err := validateRepoRoot(lp.Repo); err != nil {
+		return fmt.Errorf("invalid repository %q: %v", lp.Repo, err)
+	}
+	// The revision is passed to commands, so it mustn't pass for
+	// an option, or for a ref that the remote could move.
+	if !objectIDRe.MatchString(lp.Revision) {
+		return fmt.Errorf("invalid revision %q: not a full hexadecimal object ID", lp.Revision)
+	}
+	if err := d.Policy.checkRepo(lp.ImportPath, vcs.cmd, lp.Repo); err != nil {
+		return err
+	}
+
+	root := filepath.Join(d.srcRoot, filepath.FromSlash(lp.Root))
+	ctx := d.toCmdContext(lp.ImportPath, root).withRepo(lp.Repo)
+	if err := checkNestedVCS(vcs, root, d.srcRoot); err != nil {
+		return err
+	}
+	if err := checkGOVCS(ctx, vcs, lp.Root); err != nil {
+		return err
+	}
+
+	var prev *checkoutState // what an existing checkout had before
+	if _, err := os.Stat(filepath.Join(root, "."+vcs.cmd)); err != nil {
+		if _, err := os.Stat(root); err == nil {
+			return &Error{Kind: ErrStaleCheckout, Err: fmt.Errorf("%s exists but is not a %s checkout - stale checkout?", root, vcs.name)}
+		}
+		if err := os.MkdirAll(filepath.Dir(root), 0777); err != nil {
+			return err
+		}
+		done := ctx.step(Event{Kind: EventCloneStart, VCS: vcs.cmd, Repo: lp.Repo, Dir: root}, EventCloneDone)
+		err = ctx.retry("clone", func() error { return vcs.create(ctx, root, lp.Repo) })
+		done(err)
+		if err != nil {
+			return err
+		}
+	} else {
+		if err := checkRemote(ctx, vcs, lp.Repo); err != nil {
+			return err
+		}
+		prev = saveCheckout(ctx, vcs, root)
+		done := ctx.step(Event{Kind: EventFetchStart, VCS: vcs.cmd, Repo: lp.Repo, Dir: root}, EventFetchDone)
+		err = ctx.retry("fetch", func() error {
+			for _, cmd := range vcs.fetchCmd {
+				if err := vcs.run(ctx, cmd); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		done(err)
+		if err != nil {
+			return err
+		}
+	}
+
+	out, err := vcs.runOutput(ctx, vcs.hasRevisionCmd, "rev", lp.Revision)
+	if err != nil || len(strings.TrimSpace(string(out))) == 0 {
+		return &Error{Kind: ErrRefNotFound, Err: fmt.Errorf("%s no longer has revision %s", lp.Repo, lp.Revision)}
+	}
+
+	restore, err := d.prepareUpdate(ctx, vcs, root)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr := restore(); err == nil {
+			err = rerr
+		}
+	}()
+	done := ctx.step(Event{Kind: EventCheckoutStart, VCS: vcs.cmd, Repo: lp.Repo, Dir: root, Ref: lp.Revision}, EventCheckoutDone)
+	for _, cmd := range vcs.tagSyncCmd {
+		if err = vcs.run(ctx, cmd, "tag", lp.Revision); err != nil {
+			break
+		}
+	}
+	done(err)
+	if err != nil {
+		return err
+	}
+
+	err = d.scanCheckout(lp.ImportPath, root)
+	if err == nil {
+		_, err = d.verifySignature(ctx, vcs, lp.Root, root, lp.Query)
+	}
+	if err == nil {
+		err = d.VerifyHash(lp.ImportPath, lp.Hash)
+	}
+	if err != nil {
+		prev.rollback(ctx, vcs, root)
+		return err
+	}
+	d.setQuery(ctx, lp.Root, lp.Query, lp.Revision)
+	return nil
+}
+
+// objectIDRe matches a full SHA-1 or SHA-256 object ID.
+var objectIDRe = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+
+// checkRemote checks that the checkout ctx runs in was cloned from repo,
+// so that a lock isn't verified against an unrelated repository.
+func checkRemote(ctx cmdContext, vcs *vcsCmd, repo string) error {
+	if vcs.remoteRepo == nil {
+		return nil
+	}
+	remote, err := vcs.remoteRepo(vcs, ctx)
+	if err != nil {
+		return &Error{Kind: ErrStaleCheckout, Err: fmt.Errorf("%s: cannot determine the remote: %v", ctx.dir, err)}
+	}
+	trim := func(s string) string {
+		return strings.TrimSuffix(strings.TrimSuffix(s, "/"), ".git")
+	}
+	if trim(remote) != trim(repo) {
+		return &Error{Kind: ErrStaleCheckout, Err: fmt.Errorf("%s is a checkout of %s, not %s", ctx.dir, remote, repo)}
+	}
+	return nil
+}
+
+// A queryEntry is the ref a repository was last synced to, as kept in
+// .go-get-cache/query in the source root for WriteLock.
+type queryEntry struct {
+	Root     string
+	Query    string
+	Revision string // what Query resolved to, or "" if unknown
+}
+
+// queryFile returns the file recording the query of the repository at root.
+func (d *Downloader) queryFile(root string) string {
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(d.srcRoot, ".go-get-cache", "query", hex.EncodeToString(sum[:])+".json")
+}
+
+// setQuery records that the repository at root was synced to query,
+// which resolved to rev, for WriteLock.
+func (d *Downloader) setQuery(ctx cmdContext, root, query, rev string) {
+	e := queryEntry{Root: root, Query: query, Revision: rev}
+	if err := writeCacheFile(d.queryFile(root), e); err != nil {
+		ctx.log(LevelDebug, "recording query failed", "root", root, "err", err)
+	}
+}
+
+// clearQuery forgets the query of the repository at root, whose
+// checkout is no longer at the ref of an earlier RefSync.
+func (d *Downloader) clearQuery(root string) {
+	os.Remove(d.queryFile(root))
+}
+
+// query returns the ref the repository at root was last synced to,
+// or "" if there is none or the checkout has moved from rev since.
+func (d *Downloader) query(root, rev string) string {
+	data, err := ioutil.ReadFile(d.queryFile(root))
+	if err != nil {
+		return ""
+	}
+	var e queryEntry
+	if json.Unmarshal(data, &e) != nil || e.Root != root || e.Revision != "" && e.Revision != rev {
+		return ""
+	}
+	return e.Query
+}
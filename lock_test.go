@@ -0,0 +1,184 @@
+package get
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	lockTestPkg = "github.com/tilt-dev/lock-test/ext"
+	lockTestURL = "https://github.com/tilt-dev/lock-test"
+)
+
+// lockTestRepo creates a repository with a v1 tag and a later commit.
+func lockTestRepo(t *testing.T) string {
+	t.Helper()
+	repo := gitRepo(t, map[string]string{"ext/Tiltfile": "v1"})
+	runGit(t, repo, "tag", "v1")
+	gitCommit(t, repo, map[string]string{"ext/Tiltfile": "v2"})
+	return repo
+}
+
+// cloneLockTest clones repo into srcRoot as if from the repository the
+// lock test's import path resolves to, which git is told to fetch from repo.
+func cloneLockTest(t *testing.T, srcRoot, repo string) string {
+	t.Helper()
+	dir := cloneInto(t, srcRoot, "github.com/tilt-dev/lock-test", repo)
+	runGit(t, dir, "remote", "set-url", "origin", lockTestURL)
+	runGit(t, dir, "config", "url."+repo+".insteadOf", lockTestURL)
+	return dir
+}
+
+func readLock(t *testing.T, path string) Lock {
+	t.Helper()
+	var lock Lock
+	require.NoError(t, json.Unmarshal([]byte(readFile(t, path)), &lock))
+	return lock
+}
+
+func writeLock(t *testing.T, path string, lock Lock) {
+	t.Helper()
+	data, err := json.Marshal(lock)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, data, 0644))
+}
+
+func TestLock(t *testing.T) {
+	repo := lockTestRepo(t)
+	v1 := runGit(t, repo, "rev-parse", "v1")
+
+	srcRoot := setupDir(t)
+	cloneLockTest(t, srcRoot, repo)
+	d := NewDownloader(srcRoot)
+	require.NoError(t, d.RefSync(lockTestPkg, "v1"))
+
+	lockFile := filepath.Join(tmpdir(t), "lock.json")
+	require.NoError(t, d.WriteLock(lockFile, []string{lockTestPkg}))
+	lock := readLock(t, lockFile)
+	require.Len(t, lock.Packages, 1)
+	lp := lock.Packages[0]
+	assert.Equal(t, lockTestPkg, lp.ImportPath)
+	assert.Equal(t, lockTestURL, lp.Repo)
+	assert.Equal(t, "git", lp.VCS)
+	assert.Equal(t, "github.com/tilt-dev/lock-test", lp.Root)
+	assert.Equal(t, "v1", lp.Query)
+	assert.Equal(t, v1, lp.Revision)
+	assert.Regexp(t, `^h1:[A-Za-z0-9+/]{43}=$`, lp.Hash)
+
+	// A second checkout at the latest revision should be moved back to v1.
+	srcRoot2 := setupDir(t)
+	dir2 := cloneLockTest(t, srcRoot2, repo)
+	d2 := NewDownloader(srcRoot2)
+	require.NoError(t, d2.InstallFromLock(lockFile))
+	assert.Equal(t, v1, runGit(t, dir2, "rev-parse", "HEAD"))
+	assert.Equal(t, "v1", readFile(t, filepath.Join(dir2, "ext", "Tiltfile")))
+}
+
+func TestInstallFromLockMismatch(t *testing.T) {
+	repo := lockTestRepo(t)
+	srcRoot := setupDir(t)
+	dir := cloneLockTest(t, srcRoot, repo)
+	d := NewDownloader(srcRoot)
+
+	lockFile := filepath.Join(tmpdir(t), "lock.json")
+	require.NoError(t, d.WriteLock(lockFile, []string{lockTestPkg}))
+	lock := readLock(t, lockFile)
+
+	tampered := lock
+	tampered.Packages = []LockedPackage{lock.Packages[0]}
+	tampered.Packages[0].Hash = "h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	writeLock(t, lockFile, tampered)
+	err := d.InstallFromLock(lockFile)
+	assert.True(t, errors.Is(err, ErrChecksumMismatch), "got %v", err)
+
+	// A commit that only exists locally isn't on the remote.
+	gitCommit(t, dir, map[string]string{"ext/Tiltfile": "local"})
+	missing := lock
+	missing.Packages = []LockedPackage{lock.Packages[0]}
+	missing.Packages[0].Revision = runGit(t, dir, "rev-parse", "HEAD")
+	writeLock(t, lockFile, missing)
+	err = d.InstallFromLock(lockFile)
+	assert.True(t, errors.Is(err, ErrRefNotFound), "got %v", err)
+}
+
+func TestInstallFromLockChecks(t *testing.T) {
+	repo := lockTestRepo(t)
+	srcRoot := setupDir(t)
+	dir := cloneLockTest(t, srcRoot, repo)
+	d := NewDownloader(srcRoot)
+	lockFile := filepath.Join(tmpdir(t), "lock.json")
+	require.NoError(t, d.WriteLock(lockFile, []string{lockTestPkg}))
+	lock := readLock(t, lockFile)
+
+	// Revisions that aren't full object IDs are refused before any
+	// command sees them.
+	for _, rev := range []string{"--upload-pack=touch /tmp/pwned", "v1", "HEAD", runGit(t, repo, "rev-parse", "--short", "v1")} {
+		bad := Lock{Packages: []LockedPackage{lock.Packages[0]}}
+		bad.Packages[0].Revision = rev
+		writeLock(t, lockFile, bad)
+		err := d.InstallFromLock(lockFile)
+		if assert.Error(t, err, rev) {
+			assert.Contains(t, err.Error(), "not a full hexadecimal object ID", rev)
+		}
+	}
+
+	// A checkout of another repository isn't verified against the lock.
+	writeLock(t, lockFile, lock)
+	runGit(t, dir, "remote", "set-url", "origin", "https://github.com/someone-else/lock-test")
+	err := d.InstallFromLock(lockFile)
+	assert.True(t, errors.Is(err, ErrStaleCheckout), "got %v", err)
+}
+
+func TestWriteLockAfterDownload(t *testing.T) {
+	repo := lockTestRepo(t)
+	srcRoot := setupDir(t)
+	cloneLockTest(t, srcRoot, repo)
+	d := NewDownloader(srcRoot)
+	require.NoError(t, d.RefSync(lockTestPkg, "v1"))
+	runGit(t, filepath.Join(srcRoot, "github.com/tilt-dev/lock-test"), "checkout", "-q", "-")
+	_, err := d.Download(lockTestPkg)
+	require.NoError(t, err)
+
+	// The checkout is no longer at v1, so v1 isn't recorded.
+	lockFile := filepath.Join(tmpdir(t), "lock.json")
+	require.NoError(t, d.WriteLock(lockFile, []string{lockTestPkg}))
+	lock := readLock(t, lockFile)
+	require.Len(t, lock.Packages, 1)
+	assert.Equal(t, "", lock.Packages[0].Query)
+	assert.Equal(t, runGit(t, repo, "rev-parse", "HEAD"), lock.Packages[0].Revision)
+}
+
+func TestWriteLockNewProcess(t *testing.T) {
+	repo := lockTestRepo(t)
+	srcRoot := setupDir(t)
+	dir := cloneLockTest(t, srcRoot, repo)
+	require.NoError(t, NewDownloader(srcRoot).RefSync(lockTestPkg, "v1"))
+
+	// Another Downloader, as in a later run, records the query.
+	lockFile := filepath.Join(tmpdir(t), "lock.json")
+	require.NoError(t, NewDownloader(srcRoot).WriteLock(lockFile, []string{lockTestPkg}))
+	lock := readLock(t, lockFile)
+	require.Len(t, lock.Packages, 1)
+	assert.Equal(t, "v1", lock.Packages[0].Query)
+
+	// So does one installing from the lock.
+	srcRoot2 := setupDir(t)
+	cloneLockTest(t, srcRoot2, repo)
+	require.NoError(t, NewDownloader(srcRoot2).InstallFromLock(lockFile))
+	lockFile2 := filepath.Join(tmpdir(t), "lock.json")
+	require.NoError(t, NewDownloader(srcRoot2).WriteLock(lockFile2, []string{lockTestPkg}))
+	assert.Equal(t, lock, readLock(t, lockFile2))
+
+	// A checkout moved by other means is no longer at the query.
+	runGit(t, dir, "checkout", "-q", "-")
+	require.NoError(t, NewDownloader(srcRoot).WriteLock(lockFile, []string{lockTestPkg}))
+	lock = readLock(t, lockFile)
+	require.Len(t, lock.Packages, 1)
+	assert.Equal(t, "", lock.Packages[0].Query)
+}
@@ -0,0 +1,107 @@
+package get
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// A Level is the importance of a log record.
+//
+// The values match those of log/slog's Level, so a Level can be converted
+// directly with slog.Level(l).
+type Level int
+
+const (
+	LevelDebug Level = -4 // commands run, probes and other routine detail
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8 // failed commands and their output
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// A Logger receives the diagnostics produced while downloading.
+//
+// Like log/slog, each record is a message plus alternating key/value pairs.
+// To send records to a *slog.Logger, wrap it with LoggerFunc:
+//
+//	get.LoggerFunc(func(l get.Level, msg string, kv ...interface{}) {
+//		logger.Log(context.Background(), slog.Level(l), msg, kv...)
+//	})
+type Logger interface {
+	Log(level Level, msg string, keyvals ...interface{})
+}
+
+// LoggerFunc adapts an ordinary function to a Logger.
+type LoggerFunc func(level Level, msg string, keyvals ...interface{})
+
+func (f LoggerFunc) Log(level Level, msg string, keyvals ...interface{}) {
+	f(level, msg, keyvals...)
+}
+
+// NewTextLogger returns a Logger that writes each record at or above min
+// to w as a single line of the form
+//
+//	LEVEL msg key=value key=value
+//
+// Multi-line values, such as command output, are quoted.
+func NewTextLogger(w io.Writer, min Level) Logger {
+	return &textLogger{w: w, min: min}
+}
+
+type textLogger struct {
+	mu  sync.Mutex
+	w   io.Writer
+	min Level
+}
+
+func (l *textLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	if level < l.min {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteString(" ")
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		var v interface{} = "!MISSING"
+		if i+1 < len(keyvals) {
+			v = keyvals[i+1]
+		}
+		s := fmt.Sprint(v)
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+			s = fmt.Sprintf("%q", s)
+		}
+		fmt.Fprintf(&b, " %v=%s", keyvals[i], s)
+	}
+	b.WriteString("\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = io.WriteString(l.w, b.String())
+}
+
+// log sends a record to the context's logger, if any.
+func (ctx cmdContext) log(level Level, msg string, keyvals ...interface{}) {
+	if ctx.logger == nil {
+		return
+	}
+	if ctx.importPath != "" {
+		keyvals = append([]interface{}{"importPath", ctx.importPath}, keyvals...)
+	}
+	ctx.logger.Log(level, redact(msg), redactKeyvals(keyvals)...)
+}
@@ -0,0 +1,56 @@
+package get
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type logRecord struct {
+	level   Level
+	msg     string
+	keyvals map[string]interface{}
+}
+
+// recordLogger returns a Logger that appends each record to *records.
+func recordLogger(records *[]logRecord) Logger {
+	return LoggerFunc(func(level Level, msg string, keyvals ...interface{}) {
+		r := logRecord{level: level, msg: msg, keyvals: map[string]interface{}{}}
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			r.keyvals[keyvals[i].(string)] = keyvals[i+1]
+		}
+		*records = append(*records, r)
+	})
+}
+
+func TestTextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewTextLogger(&buf, LevelInfo)
+	l.Log(LevelDebug, "hidden")
+	l.Log(LevelError, "command failed", "cmd", "git pull", "exit", 1, "output", "fatal: nope")
+	assert.Equal(t, "ERROR command failed cmd=\"git pull\" exit=1 output=\"fatal: nope\"\n", buf.String())
+}
+
+func TestLogCommands(t *testing.T) {
+	dir := gitRepo(t, nil)
+	var records []logRecord
+	ctx := newCmdContext(dir, recordLogger(&records))
+
+	_, err := vcsGit.runOutput(ctx, "rev-parse HEAD")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, LevelDebug, records[0].level)
+	assert.Equal(t, "git rev-parse HEAD", records[0].keyvals["cmd"])
+	assert.Equal(t, 0, records[0].keyvals["exit"])
+	assert.Contains(t, records[0].keyvals, "duration")
+
+	records = nil
+	err = vcsGit.run(ctx, "rev-parse no-such-ref")
+	require.Error(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, LevelError, records[1].level)
+	assert.Equal(t, 128, records[1].keyvals["exit"])
+	assert.Contains(t, records[1].keyvals["output"], "no-such-ref")
+}
@@ -0,0 +1,179 @@
+package get
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventKind identifies the step of a download that an Event describes.
+type EventKind int
+
+const (
+	EventResolveStart  EventKind = iota // resolving an import path to a repository
+	EventResolveDone                    // finished resolving an import path
+	EventSchemeProbe                    // probed a scheme for a schemeless repository
+	EventCloneStart                     // cloning a new copy of a repository
+	EventCloneDone                      // finished cloning
+	EventFetchStart                     // fetching updates into an existing copy
+	EventFetchDone                      // finished fetching
+	EventCheckoutStart                  // syncing the working tree to a ref
+	EventCheckoutDone                   // finished syncing the working tree
+	EventProgress                       // transfer progress reported by the VCS
+)
+
+var eventKindNames = [...]string{
+	EventResolveStart:  "resolve-start",
+	EventResolveDone:   "resolve-done",
+	EventSchemeProbe:   "scheme-probe",
+	EventCloneStart:    "clone-start",
+	EventCloneDone:     "clone-done",
+	EventFetchStart:    "fetch-start",
+	EventFetchDone:     "fetch-done",
+	EventCheckoutStart: "checkout-start",
+	EventCheckoutDone:  "checkout-done",
+	EventProgress:      "progress",
+}
+
+func (k EventKind) String() string {
+	if k >= 0 && int(k) < len(eventKindNames) {
+		return eventKindNames[k]
+	}
+	return "EventKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// An Event describes one step of resolving or downloading a package.
+//
+// Fields that don't apply to a given Kind are left at their zero value.
+type Event struct {
+	Kind       EventKind
+	ImportPath string // import path being resolved or downloaded
+	VCS        string // vcs command ("git", "hg", ...), once known
+	Repo       string // repository URL, once known
+	Scheme     string // scheme probed, for EventSchemeProbe
+	Dir        string // local directory of the repository root
+	Ref        string // requested ref, for EventCheckout*; empty means the default
+
+	// Duration is the time the step took, for the *Done events.
+	Duration time.Duration
+
+	// Err is the error the step failed with, if any, for the *Done events
+	// and EventSchemeProbe.
+	Err error
+
+	// Progress is the transfer progress, for EventProgress.
+	Progress Progress
+}
+
+// Progress is a transfer progress update parsed from the VCS output,
+// e.g. from the "Receiving objects" lines of git --progress.
+type Progress struct {
+	Phase   string // e.g. "Receiving objects" or "remote: Counting objects"
+	Current int64  // objects processed so far
+	Total   int64  // total objects, or 0 if unknown
+	Bytes   int64  // bytes transferred so far, if reported
+	Done    bool   // whether the phase has finished
+}
+
+// An Observer receives Events as a Downloader works.
+//
+// Observe is called synchronously from the goroutine running the download,
+// so it should return promptly.
+type Observer interface {
+	Observe(e Event)
+}
+
+// ObserverFunc adapts an ordinary function to an Observer.
+type ObserverFunc func(e Event)
+
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
+
+// emit sends e to the context's observer, if any, filling in the import path.
+func (ctx cmdContext) emit(e Event) {
+	if ctx.observer == nil {
+		return
+	}
+	if e.ImportPath == "" {
+		e.ImportPath = ctx.importPath
+	}
+	e.Repo = redact(e.Repo)
+	ctx.observer.Observe(e)
+}
+
+// step emits e as the start of a step and returns a function that emits
+// the matching done event with the step's duration and result.
+func (ctx cmdContext) step(e Event, done EventKind) func(err error) {
+	ctx.emit(e)
+	start := time.Now()
+	return func(err error) {
+		e.Kind = done
+		e.Duration = time.Since(start)
+		e.Err = err
+		ctx.emit(e)
+	}
+}
+
+// progressRe matches a git progress line such as
+//
+//	Receiving objects:  45% (450/1000), 1.20 MiB | 2.00 MiB/s
+//	remote: Counting objects: 100% (5/5), done.
+var progressRe = regexp.MustCompile(`^((?:remote: )?[A-Z][a-z]+(?: [a-z]+)*):\s+\d+% \((\d+)/(\d+)\)(?:, ([0-9.]+) (bytes|KiB|MiB|GiB))?`)
+
+// parseProgress parses a single line of git --progress output.
+func parseProgress(line string) (Progress, bool) {
+	m := progressRe.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return Progress{}, false
+	}
+	p := Progress{Phase: m[1]}
+	p.Current, _ = strconv.ParseInt(m[2], 10, 64)
+	p.Total, _ = strconv.ParseInt(m[3], 10, 64)
+	if m[4] != "" {
+		n, _ := strconv.ParseFloat(m[4], 64)
+		switch m[5] {
+		case "KiB":
+			n *= 1 << 10
+		case "MiB":
+			n *= 1 << 20
+		case "GiB":
+			n *= 1 << 30
+		}
+		p.Bytes = int64(n)
+	}
+	p.Done = strings.HasSuffix(strings.TrimSpace(line), "done.")
+	return p, true
+}
+
+// progressWriter is an io.Writer that parses git --progress output
+// and emits an EventProgress for each progress line.
+//
+// Git separates updates to the same line with carriage returns
+// and finished lines with newlines, so both end a line here.
+type progressWriter struct {
+	ctx  cmdContext
+	base Event
+	buf  []byte
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		line := string(w.buf[:i])
+		w.buf = w.buf[i+1:]
+		if prog, ok := parseProgress(line); ok {
+			e := w.base
+			e.Kind = EventProgress
+			e.Progress = prog
+			w.ctx.emit(e)
+		}
+	}
+	return len(p), nil
+}
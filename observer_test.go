@@ -0,0 +1,56 @@
+package get
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProgress(t *testing.T) {
+	tests := []struct {
+		line string
+		want Progress
+		ok   bool
+	}{
+		{"Receiving objects:  45% (450/1000), 1.50 MiB | 2.00 MiB/s",
+			Progress{Phase: "Receiving objects", Current: 450, Total: 1000, Bytes: 1572864}, true},
+		{"Receiving objects: 100% (1000/1000), 512 bytes | 512.00 KiB/s, done.",
+			Progress{Phase: "Receiving objects", Current: 1000, Total: 1000, Bytes: 512, Done: true}, true},
+		{"remote: Counting objects: 100% (5/5), done.",
+			Progress{Phase: "remote: Counting objects", Current: 5, Total: 5, Done: true}, true},
+		{"Resolving deltas:  50% (1/2)",
+			Progress{Phase: "Resolving deltas", Current: 1, Total: 2}, true},
+		{"Cloning into 'foo'...", Progress{}, false},
+		{"remote: Enumerating objects: 5, done.", Progress{}, false},
+	}
+	for _, test := range tests {
+		got, ok := parseProgress(test.line)
+		if ok != test.ok || got != test.want {
+			t.Errorf("parseProgress(%q) = %+v, %v; want %+v, %v", test.line, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestObserveClone(t *testing.T) {
+	repo := gitRepo(t, map[string]string{"Tiltfile": `print("Hello world!")`})
+	dest := filepath.Join(setupDir(t), "repo")
+
+	var events []Event
+	ctx := newCmdContext(".", nil)
+	ctx.importPath = "example.com/repo.git"
+	ctx.observer = ObserverFunc(func(e Event) { events = append(events, e) })
+
+	require.NoError(t, vcsGit.create(ctx, dest, "file://"+repo))
+
+	var phases []string
+	for _, e := range events {
+		assert.Equal(t, EventProgress, e.Kind)
+		assert.Equal(t, "example.com/repo.git", e.ImportPath)
+		if e.Progress.Done {
+			phases = append(phases, e.Progress.Phase)
+		}
+	}
+	assert.Contains(t, phases, "Receiving objects")
+}
@@ -0,0 +1,196 @@
+package get
+
+import (
+	"fmt"
+	urlpkg "net/url"
+	"path"
+	"strings"
+
+	"github.com/tilt-dev/go-get/internal/module"
+)
+
+// A Policy decides which repositories a Downloader may fetch.
+//
+// Rules are tried in order and the first one that matches decides.
+// The policy is checked against the import path before it is resolved,
+// against each repository URL resolving would contact, before it does,
+// and against the repository it resolves to, so that neither probing
+// nor a redirect reaches a forbidden host. Until the repository is
+// resolved, the first rule that constrains something not yet known,
+// such as the host, VCS or scheme, defers the decision to a later check.
+type Policy struct {
+	Rules []PolicyRule
+
+	// DefaultDeny denies repositories that no rule matches.
+	// By default they are allowed.
+	DefaultDeny bool
+}
+
+// A PolicyAction says what a matching PolicyRule does.
+type PolicyAction int
+
+const (
+	PolicyAllow PolicyAction = iota
+	PolicyDeny
+)
+
+func (a PolicyAction) String() string {
+	switch a {
+	case PolicyAllow:
+		return "allow"
+	case PolicyDeny:
+		return "deny"
+	}
+	return fmt.Sprintf("PolicyAction(%d)", int(a))
+}
+
+// A PolicyRule matches repositories by comma-separated lists of glob
+// patterns, in the syntax of path.Match. A rule matches when every
+// non-empty pattern list does; a rule with no patterns matches everything.
+type PolicyRule struct {
+	Action PolicyAction
+
+	// ImportPath matches import path prefixes, as GOPRIVATE does:
+	// "github.com/tilt-dev" matches every package of that org.
+	ImportPath string
+
+	// Host matches the host name of the repository URL, such as "github.com".
+	Host string
+
+	// VCS matches the version control command, such as "git" or "hg".
+	VCS string
+
+	// Scheme matches the scheme of the repository URL, such as "https" or "ssh".
+	Scheme string
+}
+
+func (r PolicyRule) String() string {
+	var b strings.Builder
+	b.WriteString(r.Action.String())
+	for _, f := range []struct{ name, pattern string }{
+		{"importpath", r.ImportPath},
+		{"host", r.Host},
+		{"vcs", r.VCS},
+		{"scheme", r.Scheme},
+	} {
+		if f.pattern != "" {
+			fmt.Fprintf(&b, " %s=%s", f.name, f.pattern)
+		}
+	}
+	return b.String()
+}
+
+// A PolicyError reports that a Policy denied a download.
+// It matches ErrPolicyDenied with errors.Is.
+type PolicyError struct {
+	Path string      // import path being downloaded
+	Repo string      // repository URL, if resolved
+	Rule *PolicyRule // the rule that denied it, or nil for the policy's default
+	N    int         // index of Rule in the policy's rules
+}
+
+func (e *PolicyError) Error() string {
+	target := e.Path
+	if e.Repo != "" {
+		target = fmt.Sprintf("%s (%s)", e.Path, e.Repo)
+	}
+	if e.Rule == nil {
+		return redact(fmt.Sprintf("%s: denied by policy: no rule allows it", target))
+	}
+	return redact(fmt.Sprintf("%s: denied by policy Rules[%d] (%s)", target, e.N, e.Rule))
+}
+
+// Is reports whether target is ErrPolicyDenied.
+func (e *PolicyError) Is(target error) bool {
+	return target == ErrPolicyDenied
+}
+
+func (e *PolicyError) ImportPath() string {
+	return e.Path
+}
+
+// policyTarget describes a download for matching against a Policy.
+// Fields that aren't known yet are empty.
+type policyTarget struct {
+	importPath string
+	repo       string
+	host       string
+	vcs        string
+	scheme     string
+}
+
+// checkImportPath checks the import path against p before resolution.
+func (p *Policy) checkImportPath(importPath string) error {
+	if p == nil {
+		return nil
+	}
+	return p.check(policyTarget{importPath: importPath}, false)
+}
+
+// checkCandidate checks a repository that resolving importPath is about
+// to contact against p. vcs is empty if it isn't known yet.
+func (p *Policy) checkCandidate(importPath, vcs, repo string) error {
+	if p == nil {
+		return nil
+	}
+	return p.check(repoTarget(importPath, vcs, repo), false)
+}
+
+// checkRepo checks the repository that importPath resolved to against p.
+func (p *Policy) checkRepo(importPath, vcs, repo string) error {
+	if p == nil {
+		return nil
+	}
+	return p.check(repoTarget(importPath, vcs, repo), true)
+}
+
+func repoTarget(importPath, vcs, repo string) policyTarget {
+	t := policyTarget{importPath: importPath, repo: repo, vcs: vcs}
+	if u, err := urlpkg.Parse(repo); err == nil && u.Scheme != "" {
+		t.scheme, t.host = u.Scheme, u.Hostname()
+	} else if m := scpSyntaxRe.FindStringSubmatch(repo); m != nil {
+		t.scheme, t.host = "ssh", m[2]
+	}
+	return t
+}
+
+// check finds the rule that decides t. If resolved is false, the empty
+// fields of t aren't known yet, and a rule that depends on one allows t
+// for now.
+func (p *Policy) check(t policyTarget, resolved bool) error {
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.ImportPath != "" && !module.MatchPrefixPatterns(r.ImportPath, t.importPath) {
+			continue
+		}
+		if !resolved && (r.Host != "" && t.host == "" || r.VCS != "" && t.vcs == "" || r.Scheme != "" && t.scheme == "") {
+			return nil
+		}
+		if !matchGlobs(r.Host, t.host) || !matchGlobs(r.VCS, t.vcs) || !matchGlobs(r.Scheme, t.scheme) {
+			continue
+		}
+		if r.Action == PolicyDeny {
+			rule := *r
+			return &PolicyError{Path: t.importPath, Repo: t.repo, Rule: &rule, N: i}
+		}
+		return nil
+	}
+	if p.DefaultDeny {
+		return &PolicyError{Path: t.importPath, Repo: t.repo}
+	}
+	return nil
+}
+
+// matchGlobs reports whether s matches one of the comma-separated
+// glob patterns in globs. An empty list matches anything.
+func matchGlobs(globs, s string) bool {
+	if globs == "" {
+		return true
+	}
+	for _, g := range strings.Split(globs, ",") {
+		if ok, _ := path.Match(strings.TrimSpace(g), s); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package get
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tilt-dev/go-get/internal/web"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	p := &Policy{
+		Rules: []PolicyRule{
+			{Action: PolicyDeny, ImportPath: "github.com/evil"},
+			{Action: PolicyDeny, Scheme: "http,git"},
+			{Action: PolicyAllow, Host: "github.com,*.corp.example.com", VCS: "git"},
+		},
+		DefaultDeny: true,
+	}
+
+	cases := []struct {
+		importPath, vcs, repo string
+		deniedBy              int // -1 if allowed, len(Rules) for the default
+	}{
+		{"github.com/tilt-dev/ext", "git", "https://github.com/tilt-dev/ext", -1},
+		{"github.com/tilt-dev/ext", "git", "git@github.com:tilt-dev/ext", -1},
+		{"github.com/evil/ext", "git", "https://github.com/evil/ext", 0},
+		{"github.com/tilt-dev/ext", "git", "http://github.com/tilt-dev/ext", 1},
+		{"go.corp.example.com/ext", "git", "ssh://git@src.corp.example.com:2222/ext", -1},
+		{"go.corp.example.com/ext", "hg", "https://src.corp.example.com/ext", 3},
+		{"example.com/ext", "git", "https://evil.example.net/ext", 3},
+	}
+	for _, c := range cases {
+		err := p.checkRepo(c.importPath, c.vcs, c.repo)
+		if c.deniedBy < 0 {
+			assert.NoError(t, err, c.repo)
+			continue
+		}
+		var perr *PolicyError
+		if !assert.True(t, errors.As(err, &perr), "%s: %v", c.repo, err) {
+			continue
+		}
+		assert.True(t, errors.Is(err, ErrPolicyDenied))
+		assert.Equal(t, c.importPath, perr.Path)
+		assert.Equal(t, c.repo, perr.Repo)
+		if c.deniedBy == len(p.Rules) {
+			assert.Nil(t, perr.Rule, c.repo)
+		} else if assert.NotNil(t, perr.Rule, c.repo) {
+			assert.Equal(t, c.deniedBy, perr.N, c.repo)
+			assert.Equal(t, p.Rules[c.deniedBy], *perr.Rule)
+		}
+	}
+
+	// Before resolution, the import path alone can deny a download,
+	// but a rule that needs the repository defers the decision.
+	assert.True(t, errors.Is(p.checkImportPath("github.com/evil/ext"), ErrPolicyDenied))
+	assert.NoError(t, p.checkImportPath("example.com/ext"))
+	assert.NoError(t, (&Policy{DefaultDeny: true, Rules: []PolicyRule{{ImportPath: "example.com"}}}).checkImportPath("example.com/ext"))
+	assert.Error(t, (&Policy{DefaultDeny: true, Rules: []PolicyRule{{ImportPath: "example.com"}}}).checkImportPath("example.org/ext"))
+}
+
+func TestPolicyErrorMessage(t *testing.T) {
+	p := &Policy{Rules: []PolicyRule{{Action: PolicyDeny, Host: "github.com", Scheme: "ssh"}}}
+	err := p.checkRepo("github.com/tilt-dev/ext", "git", "ssh://git@github.com/tilt-dev/ext")
+	assert.EqualError(t, err, "github.com/tilt-dev/ext (ssh://git@github.com/tilt-dev/ext): denied by policy Rules[0] (deny host=github.com scheme=ssh)")
+}
+
+func TestDownloaderPolicy(t *testing.T) {
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	runGit(t, repo, "tag", "v1")
+	srcRoot := setupDir(t)
+	cloneInto(t, srcRoot, "github.com/tilt-dev/policy-test", repo)
+
+	d := NewDownloader(srcRoot)
+	d.Policy = &Policy{Rules: []PolicyRule{{Action: PolicyDeny, Host: "github.com"}}}
+	err := d.RefSync("github.com/tilt-dev/policy-test", "v1")
+	assert.True(t, errors.Is(err, ErrPolicyDenied), "%v", err)
+	_, err = d.Download("github.com/tilt-dev/policy-test")
+	assert.True(t, errors.Is(err, ErrPolicyDenied), "%v", err)
+
+	d.Policy.Rules = append([]PolicyRule{{Action: PolicyAllow, ImportPath: "github.com/tilt-dev"}}, d.Policy.Rules...)
+	require.NoError(t, d.RefSync("github.com/tilt-dev/policy-test", "v1"))
+
+	// Lock files name their repositories directly, so the policy
+	// applies to them too.
+	lockFile := filepath.Join(tmpdir(t), "lock.json")
+	require.NoError(t, d.WriteLock(lockFile, []string{"github.com/tilt-dev/policy-test"}))
+	d.Policy.Rules = d.Policy.Rules[1:]
+	err = d.InstallFromLock(lockFile)
+	assert.True(t, errors.Is(err, ErrPolicyDenied), "%v", err)
+}
+
+func TestPolicyBeforeContact(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	// A fake git, whose every repository answers ls-remote.
+	bin := tmpdir(t)
+	log := filepath.Join(bin, "git.log")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(bin, "git"), []byte(`#!/bin/sh
+echo "$@" >> '`+log+`'
+exit 0
+`), 0755))
+	setenv(t, "PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	const pkg = "example.test/team/repo.git"
+	d := NewDownloader(setupDir(t))
+
+	// A denied host is never probed, nor its resolution cached.
+	d.Policy = &Policy{Rules: []PolicyRule{{Action: PolicyDeny, Host: "example.test"}}}
+	_, _, err := d.repoRoot(pkg)
+	assert.True(t, errors.Is(err, ErrPolicyDenied), "%v", err)
+	_, err = os.Stat(log)
+	assert.True(t, os.IsNotExist(err), "git was run")
+	assert.Nil(t, d.cachedRepoRoot(pkg, web.SecureOnly))
+
+	// A denied scheme isn't probed; the others are.
+	d.Policy = &Policy{Rules: []PolicyRule{{Action: PolicyDeny, Scheme: "https"}}}
+	_, rr, err := d.repoRoot(pkg)
+	require.NoError(t, err)
+	assert.Equal(t, "git+ssh://example.test/team/repo", rr.Repo)
+	assert.NotContains(t, readFile(t, log), "https://")
+
+	// A rule on the VCS defers to the resolved repository for paths
+	// whose VCS isn't known until it is probed.
+	p := &Policy{Rules: []PolicyRule{{Action: PolicyDeny, Host: "bitbucket.org", VCS: "hg"}}}
+	assert.NoError(t, p.checkCandidate("bitbucket.org/a/b", "", "https://bitbucket.org/a/b"))
+	assert.Error(t, p.checkCandidate("bitbucket.org/a/b", "hg", "https://bitbucket.org/a/b"))
+}
@@ -0,0 +1,107 @@
+package get
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// redactedText replaces the credentials that redact finds.
+const redactedText = "[redacted]"
+
+var (
+	// urlUserinfo matches the userinfo of a URL: a password, or for
+	// HTTP, where a lone username is usually a token, the username too.
+	// SSH usernames, as in ssh://git@host, are kept.
+	urlUserinfo = regexp.MustCompile(`(?i)\b((?:[a-z][a-z0-9+.\-]*)://)([^/@\s:]*)(:[^/@\s]*)?@`)
+
+	// urlQuerySecret matches the value of a query parameter whose name
+	// says it holds a secret, as in ?access_token= or &X-Amz-Signature=.
+	urlQuerySecret = regexp.MustCompile(`(?i)([?&;][\w.\-]*(?:token|password|passwd|secret|key|signature|sig|auth|credential)[\w.\-]*=)[^&;#\s"']+`)
+
+	// credentialHeader matches the value of an HTTP header that carries
+	// credentials, with the scheme of an Authorization header kept.
+	credentialHeader = regexp.MustCompile(`(?i)\b((?:proxy-)?authorization:\s*(?:(?:basic|bearer|token|digest)\s+)?|(?:private|job|deploy)-token:\s*|x-[\w\-]*(?:token|api-key):\s*)[^\s"']+`)
+)
+
+// redact returns s with the credentials it may hold replaced by
+// "[redacted]": passwords and tokens in URLs, query parameters
+// named for secrets, and the values of credential headers.
+//
+// Everything the package reports is redacted: command lines and
+// output in errors and log records, and the URLs in events.
+func redact(s string) string {
+	s = urlUserinfo.ReplaceAllStringFunc(s, redactUserinfo)
+	s = urlQuerySecret.ReplaceAllString(s, "${1}"+redactedText)
+	s = credentialHeader.ReplaceAllString(s, "${1}"+redactedText)
+	return s
+}
+
+func redactUserinfo(m string) string {
+	sub := urlUserinfo.FindStringSubmatch(m)
+	scheme, user, pass := sub[1], sub[2], sub[3]
+	if pass != "" {
+		return scheme + user + ":" + redactedText + "@"
+	}
+	switch strings.ToLower(scheme) {
+	case "http://", "https://":
+		if user != "" {
+			return scheme + redactedText + "@"
+		}
+	}
+	return m
+}
+
+// redactKeyvals returns the key-value pairs of a log record with the
+// credentials in their string and error values redacted. An error that
+// holds credentials is replaced by its redacted message.
+func redactKeyvals(keyvals []interface{}) []interface{} {
+	out := make([]interface{}, len(keyvals))
+	for i, v := range keyvals {
+		switch v := v.(type) {
+		case string:
+			out[i] = redact(v)
+		case error:
+			out[i] = v
+			if s := v.Error(); redact(s) != s {
+				out[i] = redact(s)
+			}
+		default:
+			out[i] = v
+		}
+	}
+	return out
+}
+
+// A redactWriter writes the output of a command to w a line at a time,
+// with credentials redacted. As for progressWriter, carriage returns
+// and newlines both end a line.
+type redactWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (w *redactWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	i := bytes.LastIndexAny(w.buf, "\r\n")
+	if i < 0 {
+		return len(p), nil
+	}
+	lines := w.buf[:i+1]
+	w.buf = append([]byte(nil), w.buf[i+1:]...)
+	if _, err := io.WriteString(w.w, redact(string(lines))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes the last line, if it wasn't ended.
+func (w *redactWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w.w, redact(string(w.buf)))
+	w.buf = nil
+	return err
+}
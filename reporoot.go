@@ -0,0 +1,144 @@
+package get
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	urlpkg "net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tilt-dev/go-get/internal/web"
+)
+
+// defaultRepoRootTTL is how long a resolved repository root is reused
+// when Downloader.RepoRootTTL is zero.
+const defaultRepoRootTTL = 24 * time.Hour
+
+// A repoRootEntry is a resolved repository root, as cached by a
+// Downloader in memory and in .go-get-cache/reporoot.
+type repoRootEntry struct {
+	ImportPath string
+	Repo       string // including the scheme found by probing
+	Root       string
+	VCS        string
+	IsCustom   bool
+	Resolved   time.Time
+}
+
+func (d *Downloader) repoRootTTL() time.Duration {
+	if d.RepoRootTTL == 0 {
+		return defaultRepoRootTTL
+	}
+	return d.RepoRootTTL
+}
+
+// repoRootFile returns the file caching the repository root of pkg.
+func (d *Downloader) repoRootFile(pkg string) string {
+	sum := sha256.Sum256([]byte(pkg))
+	return filepath.Join(d.srcRoot, ".go-get-cache", "reporoot", hex.EncodeToString(sum[:])+".json")
+}
+
+// cachedRepoRoot returns the cached repository root of pkg, or nil if
+// there is none younger than the TTL that resolving pkg in the given
+// security mode could have chosen. The cache files are only as
+// trustworthy as the source root, and may have been written with
+// other settings.
+func (d *Downloader) cachedRepoRoot(pkg string, security web.SecurityMode) *repoRoot {
+	ttl := d.repoRootTTL()
+	if ttl < 0 {
+		return nil
+	}
+	e, ok := d.roots[pkg]
+	if !ok {
+		data, err := ioutil.ReadFile(d.repoRootFile(pkg))
+		if err != nil || json.Unmarshal(data, &e) != nil || e.ImportPath != pkg {
+			return nil
+		}
+	}
+	vcs := vcsByCmd(e.VCS)
+	if vcs == nil || !allowedScheme(vcs, e.Repo, security) || time.Since(e.Resolved) >= ttl {
+		return nil
+	}
+	if d.roots == nil {
+		d.roots = make(map[string]repoRootEntry)
+	}
+	d.roots[pkg] = e
+	return &repoRoot{Repo: e.Repo, Root: e.Root, IsCustom: e.IsCustom, VCS: e.VCS, vcs: vcs}
+}
+
+// allowedScheme reports whether probing for vcs in the given security
+// mode could choose the scheme of repo.
+func allowedScheme(vcs *vcsCmd, repo string, security web.SecurityMode) bool {
+	if validateRepoRoot(repo) != nil {
+		return false
+	}
+	u, err := urlpkg.Parse(repo)
+	if err != nil {
+		return false
+	}
+	if security == web.SecureOnly && !vcs.isSecureScheme(u.Scheme) {
+		return false
+	}
+	for _, s := range vcs.scheme {
+		if s == u.Scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// saveRepoRoot caches rr as the repository root of pkg.
+func (d *Downloader) saveRepoRoot(pkg string, rr *repoRoot) error {
+	if d.repoRootTTL() < 0 {
+		return nil
+	}
+	e := repoRootEntry{
+		ImportPath: pkg,
+		Repo:       rr.Repo,
+		Root:       rr.Root,
+		VCS:        rr.VCS,
+		IsCustom:   rr.IsCustom,
+		Resolved:   time.Now(),
+	}
+	if d.roots == nil {
+		d.roots = make(map[string]repoRootEntry)
+	}
+	d.roots[pkg] = e
+
+	return writeCacheFile(d.repoRootFile(pkg), e)
+}
+
+// writeCacheFile replaces file with v in JSON, creating its directory
+// as needed. Readers see the old file or the new one, never a part.
+func writeCacheFile(file string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(file), "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), file)
+}
+
+// forgetRepoRoot drops the cached repository root of pkg, such as after
+// a clone or fetch from it failed, so that the next use resolves it again.
+func (d *Downloader) forgetRepoRoot(pkg string) {
+	delete(d.roots, pkg)
+	os.Remove(d.repoRootFile(pkg))
+}
@@ -0,0 +1,98 @@
+package get
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoRootCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	// A fake git, whose every repository answers ls-remote
+	// and fails to clone.
+	bin := tmpdir(t)
+	log := filepath.Join(bin, "git.log")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(bin, "git"), []byte(`#!/bin/sh
+echo "$@" >> '`+log+`'
+case "$*" in *ls-remote*) exit 0 ;; esac
+exit 1
+`), 0755))
+	setenv(t, "PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	probes := func() int {
+		data, err := ioutil.ReadFile(log)
+		if os.IsNotExist(err) {
+			return 0
+		}
+		require.NoError(t, err)
+		return strings.Count(string(data), "ls-remote")
+	}
+
+	const pkg = "example.test/team/repo.git"
+	srcRoot := setupDir(t)
+	d := NewDownloader(srcRoot)
+	_, rr, err := d.repoRoot(pkg)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.test/team/repo", rr.Repo)
+	assert.Equal(t, 1, probes())
+
+	// The resolution is reused from memory, and by another Downloader
+	// from disk.
+	_, rr, err = d.repoRoot(pkg)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.test/team/repo", rr.Repo)
+	assert.Equal(t, "git", rr.vcs.cmd)
+	d = NewDownloader(srcRoot)
+	_, rr, err = d.repoRoot(pkg)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.test/team/repo", rr.Repo)
+	assert.Equal(t, 1, probes())
+
+	// Once the TTL has passed, the path is resolved again.
+	d = NewDownloader(srcRoot)
+	d.RepoRootTTL = time.Nanosecond
+	_, _, err = d.repoRoot(pkg)
+	require.NoError(t, err)
+	assert.Equal(t, 2, probes())
+
+	// A failed clone drops the cached resolution.
+	d = NewDownloader(srcRoot)
+	_, _, err = d.repoRoot(pkg)
+	require.NoError(t, err)
+	assert.Equal(t, 2, probes())
+	_, err = d.Download(pkg)
+	require.Error(t, err)
+	_, _, err = d.repoRoot(pkg)
+	require.NoError(t, err)
+	assert.Equal(t, 3, probes())
+
+	// A cached scheme that resolving wouldn't choose, such as one written
+	// by a Downloader with other settings, or by hand, is ignored.
+	for _, repo := range []string{"http://example.test/team/repo", "git://example.test/team/repo", "file:///tmp/repo"} {
+		require.NoError(t, d.saveRepoRoot(pkg, &repoRoot{Repo: repo, Root: rr.Root, VCS: "git", vcs: vcsGit}))
+		d = NewDownloader(srcRoot)
+		_, rr, err = d.repoRoot(pkg)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.test/team/repo", rr.Repo, repo)
+	}
+	assert.Equal(t, 6, probes())
+
+	// A negative TTL disables the cache.
+	d = NewDownloader(setupDir(t))
+	d.RepoRootTTL = -1
+	for i := 0; i < 2; i++ {
+		_, _, err = d.repoRoot(pkg)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 8, probes())
+	_, err = os.Stat(filepath.Join(d.srcRoot, ".go-get-cache", "reporoot"))
+	assert.True(t, os.IsNotExist(err), "cache directory was created")
+}
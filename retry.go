@@ -0,0 +1,148 @@
+package get
+
+import (
+	"errors"
+	"math/rand"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/tilt-dev/go-get/internal/web"
+)
+
+// A RetryPolicy configures how a Downloader retries clones, fetches,
+// scheme probes and discovery requests that fail with a transient
+// network error, such as a dropped connection or an HTTP 503.
+//
+// Errors that retrying can't fix, such as a missing repository or
+// rejected credentials, are returned immediately.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Values below 2 disable retries.
+	MaxAttempts int
+
+	// InitialBackoff is the base delay before the first retry.
+	// It doubles with each further attempt, up to MaxBackoff.
+	// Defaults to 500ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between attempts. Defaults to 30s.
+	MaxBackoff time.Duration
+
+	sleep func(time.Duration) // for tests; defaults to time.Sleep
+}
+
+// backoff returns the delay before the given retry (1 for the first retry).
+// The delay is jittered between half and all of the exponential backoff,
+// so that many clients failing at once don't retry in lockstep.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	initial, max := p.InitialBackoff, p.MaxBackoff
+	if initial <= 0 {
+		initial = 500 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	d := initial
+	for i := 1; i < retry && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retry runs f, retrying it according to the context's retry policy
+// for as long as it fails with a transient error.
+// op names the operation in log records.
+func (ctx cmdContext) retry(op string, f func() error) error {
+	p := ctx.retryPolicy
+	attempt := 1
+	for {
+		err := f()
+		if err == nil || p == nil || attempt >= p.MaxAttempts || !isTransient(err) {
+			return err
+		}
+		delay := p.backoff(attempt)
+		ctx.log(LevelWarn, "retrying after transient error",
+			"op", op, "attempt", attempt, "delay", delay, "error", err)
+		sleep := p.sleep
+		if sleep == nil {
+			sleep = time.Sleep
+		}
+		sleep(delay)
+		attempt++
+	}
+}
+
+// permanentVCSErrors are fragments of VCS output indicating failures
+// that retrying won't fix, beyond those classify recognizes.
+var permanentVCSErrors = []string{
+	"host key verification failed",
+}
+
+// transientVCSErrors are fragments of VCS output indicating network
+// failures that may succeed if tried again.
+var transientVCSErrors = []string{
+	"early eof",
+	"could not resolve host",
+	"temporary failure in name resolution",
+	"connection timed out",
+	"operation timed out",
+	"connection reset",
+	"connection refused",
+	"failed to connect",
+	"the remote end hung up unexpectedly",
+	"unexpected disconnect",
+	"rpc failed",
+	"tls connection was non-properly terminated",
+	"gnutls_handshake() failed",
+	"returned error: 429",
+	"returned error: 500",
+	"returned error: 502",
+	"returned error: 503",
+	"returned error: 504",
+}
+
+// isTransient reports whether err looks like a network failure
+// that may succeed if tried again.
+func isTransient(err error) bool {
+	var httpErr *web.HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case 429, 500, 502, 503, 504:
+			return true
+		}
+		return false
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// The request never got a response: DNS, dial and TLS failures
+		// and timeouts all land here.
+		return true
+	}
+
+	switch classify(err) {
+	case ErrRepoNotFound, ErrAuthRequired, ErrRefNotFound, ErrVCSNotInstalled:
+		return false
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		out := strings.ToLower(string(exitErr.Stderr))
+		for _, s := range permanentVCSErrors {
+			if strings.Contains(out, s) {
+				return false
+			}
+		}
+		for _, s := range transientVCSErrors {
+			if strings.Contains(out, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package get
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tilt-dev/go-get/internal/web"
+)
+
+func exitError(stderr string) error {
+	return &exec.ExitError{Stderr: []byte(stderr)}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{exitError("fatal: early EOF\nfatal: index-pack failed\n"), true},
+		{exitError("fatal: unable to access 'https://github.com/a/b/': Could not resolve host: github.com\n"), true},
+		{exitError("error: RPC failed; HTTP 502 curl 22 The requested URL returned error: 502\n"), true},
+		{exitError("fatal: unable to access 'https://github.com/a/b/': The requested URL returned error: 429\n"), true},
+		{exitError("remote: Repository not found.\nfatal: repository 'https://github.com/a/b/' not found\n"), false},
+		{exitError("fatal: Authentication failed for 'https://github.com/a/b/'\n"), false},
+		{exitError("fatal: could not read Username for 'https://github.com': terminal prompts disabled\n"), false},
+		{exitError("error: pathspec 'v9' did not match any file(s) known to git\n"), false},
+		{&web.HTTPError{StatusCode: 503}, true},
+		{&web.HTTPError{StatusCode: 429}, true},
+		{&web.HTTPError{StatusCode: 404}, false},
+		{&web.HTTPError{StatusCode: 403}, false},
+		{fmt.Errorf("discovery: %w", &url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("dial tcp: i/o timeout")}), true},
+		{errors.New("invalid import path"), false},
+	}
+	for _, test := range tests {
+		if got := isTransient(test.err); got != test.transient {
+			t.Errorf("isTransient(%v) = %v, want %v", test.err, got, test.transient)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var delays []time.Duration
+	ctx := newCmdContext(".", nil)
+	ctx.retryPolicy = &RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+		sleep:          func(d time.Duration) { delays = append(delays, d) },
+	}
+
+	attempts := 0
+	err := ctx.retry("clone", func() error {
+		attempts++
+		if attempts < 4 {
+			return exitError("fatal: early EOF")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, attempts)
+	if assert.Len(t, delays, 3) {
+		for i, max := range []time.Duration{100, 200, 300} {
+			max *= time.Millisecond
+			assert.True(t, delays[i] >= max/2 && delays[i] <= max, "delay %d = %v, want in [%v, %v]", i, delays[i], max/2, max)
+		}
+	}
+
+	attempts = 0
+	err = ctx.retry("clone", func() error {
+		attempts++
+		return exitError("fatal: Authentication failed")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts, "permanent errors should not be retried")
+
+	attempts = 0
+	err = ctx.retry("clone", func() error {
+		attempts++
+		return exitError("fatal: early EOF")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 4, attempts, "should give up after MaxAttempts")
+}
@@ -0,0 +1,172 @@
+package get
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CheckoutLimits bounds what a checkout may contain, so that a hostile
+// or broken repository can't fill the disk. Zero limits are not enforced.
+type CheckoutLimits struct {
+	MaxTotalSize int64 // total bytes in regular files
+	MaxFiles     int   // number of files, counting symlinks
+	MaxFileSize  int64 // bytes in any one regular file
+}
+
+// A CheckoutError reports that a checkout failed the Downloader's scan.
+// It matches ErrUnsafeCheckout with errors.Is.
+type CheckoutError struct {
+	Path     string            // import path of the package
+	Dir      string            // root directory of the checkout
+	Problems []CheckoutProblem // in walk order
+}
+
+// A CheckoutProblem is one reason a checkout failed its scan.
+type CheckoutProblem struct {
+	File   string // slash-separated path relative to the checkout, or "" for the whole tree
+	Reason string
+}
+
+func (p CheckoutProblem) String() string {
+	if p.File == "" {
+		return p.Reason
+	}
+	return p.File + ": " + p.Reason
+}
+
+func (e *CheckoutError) Error() string {
+	var probs []string
+	for _, p := range e.Problems {
+		probs = append(probs, p.String())
+	}
+	return fmt.Sprintf("%s: unsafe checkout in %s: %s", e.Path, e.Dir, summarizePaths(probs))
+}
+
+// Files returns the paths of the offending files.
+func (e *CheckoutError) Files() []string {
+	var files []string
+	for _, p := range e.Problems {
+		if p.File != "" {
+			files = append(files, p.File)
+		}
+	}
+	return files
+}
+
+// Is reports whether target is ErrUnsafeCheckout.
+func (e *CheckoutError) Is(target error) bool {
+	return target == ErrUnsafeCheckout
+}
+
+func (e *CheckoutError) ImportPath() string {
+	return e.Path
+}
+
+// errScanLimit stops a scan once the tree is known to be too big.
+var errScanLimit = errors.New("scan limit reached")
+
+// scanCheckout checks the checkout at dir: every symlink must resolve to
+// somewhere inside dir, and the tree must be within the Downloader's Limits,
+// if any. VCS metadata isn't scanned.
+func (d *Downloader) scanCheckout(pkg, dir string) error {
+	var limits CheckoutLimits
+	if d.Limits != nil {
+		limits = *d.Limits
+	}
+	// Resolve dir itself, so that links into it compare equal
+	// even if it is reached through a symlink.
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	cerr := &CheckoutError{Path: pkg, Dir: dir}
+	problem := func(file, format string, args ...interface{}) {
+		cerr.Problems = append(cerr.Problems, CheckoutProblem{File: file, Reason: fmt.Sprintf(format, args...)})
+	}
+	var files int
+	var size int64
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if isVCSMetadata(info.Name()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		files++
+		if limits.MaxFiles > 0 && files > limits.MaxFiles {
+			problem("", "more than %d files", limits.MaxFiles)
+			return errScanLimit
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if target, ok := escapes(realDir, path); ok {
+				problem(rel, "symlink resolves outside the checkout, to %s", target)
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if limits.MaxFileSize > 0 && info.Size() > limits.MaxFileSize {
+			problem(rel, "%d bytes exceeds the limit of %d", info.Size(), limits.MaxFileSize)
+		}
+		size += info.Size()
+		if limits.MaxTotalSize > 0 && size > limits.MaxTotalSize {
+			problem("", "more than %d bytes in total", limits.MaxTotalSize)
+			return errScanLimit
+		}
+		return nil
+	})
+	if err != nil && err != errScanLimit {
+		return err
+	}
+	if len(cerr.Problems) > 0 {
+		return cerr
+	}
+	return nil
+}
+
+// escapes reports whether the symlink at path resolves to somewhere
+// outside root, and if so, where. A link that can't be resolved,
+// because its target doesn't exist yet, is judged by its text.
+func escapes(root, path string) (string, bool) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		link, err := os.Readlink(path)
+		if err != nil {
+			return "", false
+		}
+		if !filepath.IsAbs(link) {
+			realParent, err := filepath.EvalSymlinks(filepath.Dir(path))
+			if err != nil {
+				return link, true
+			}
+			link = filepath.Join(realParent, link)
+		}
+		target = filepath.Clean(link)
+	}
+	return target, !inDir(root, target)
+}
+
+// inDir reports whether path is root or inside it.
+func inDir(root, path string) bool {
+	return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
@@ -0,0 +1,82 @@
+package get
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const scanTestRoot = "github.com/tilt-dev/scan-test"
+
+func TestScanSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need special privileges on Windows")
+	}
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1", "lib/lib.star": "lib"})
+	for link, target := range map[string]string{
+		"ok":           "Tiltfile",
+		"lib/up":       "../Tiltfile",
+		"passwd":       "/etc/passwd",
+		"sibling":      "../../other-repo",
+		"lib/dangling": "../../nope",
+	} {
+		require.NoError(t, os.Symlink(target, filepath.Join(repo, filepath.FromSlash(link))))
+	}
+	gitCommit(t, repo, nil)
+	runGit(t, repo, "tag", "v1")
+
+	srcRoot := setupDir(t)
+	dir := cloneInto(t, srcRoot, scanTestRoot, repo)
+	require.NoError(t, os.MkdirAll(filepath.Join(srcRoot, "github.com", "tilt-dev", "other-repo"), 0755))
+
+	// Symlinks are checked without any Limits.
+	d := NewDownloader(srcRoot)
+	err := d.RefSync(scanTestRoot, "v1")
+	assert.True(t, errors.Is(err, ErrUnsafeCheckout), "%v", err)
+	var cerr *CheckoutError
+	require.True(t, errors.As(err, &cerr))
+	assert.Equal(t, scanTestRoot, cerr.Path)
+	assert.Equal(t, dir, cerr.Dir)
+	assert.Equal(t, []string{"lib/dangling", "passwd", "sibling"}, cerr.Files())
+	assert.Contains(t, err.Error(), "passwd: symlink resolves outside the checkout, to /etc/passwd")
+}
+
+func TestScanLimits(t *testing.T) {
+	repo := gitRepo(t, map[string]string{
+		"Tiltfile":   "small",
+		"big.bin":    strings.Repeat("x", 100),
+		"lib/a.star": "a",
+		"lib/b.star": "b",
+	})
+	runGit(t, repo, "tag", "v1")
+	srcRoot := setupDir(t)
+	cloneInto(t, srcRoot, scanTestRoot, repo)
+	d := NewDownloader(srcRoot)
+
+	for _, c := range []struct {
+		limits CheckoutLimits
+		want   string
+	}{
+		{CheckoutLimits{MaxFileSize: 50}, "big.bin: 100 bytes exceeds the limit of 50"},
+		{CheckoutLimits{MaxFiles: 3}, "more than 3 files"},
+		{CheckoutLimits{MaxTotalSize: 100}, "more than 100 bytes in total"},
+	} {
+		limits := c.limits
+		d.Limits = &limits
+		err := d.RefSync(scanTestRoot, "v1")
+		assert.True(t, errors.Is(err, ErrUnsafeCheckout), "%v", err)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), c.want)
+		}
+	}
+
+	// The .git directory doesn't count against the limits.
+	d.Limits = &CheckoutLimits{MaxFileSize: 100, MaxFiles: 4, MaxTotalSize: 107}
+	assert.NoError(t, d.RefSync(scanTestRoot, "v1"))
+}
@@ -0,0 +1,211 @@
+package get
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/tilt-dev/go-get/internal/module"
+)
+
+// A SignatureRule requires checkouts of matching repositories to be signed
+// by a trusted key. A checkout passes if any tag of the checked-out revision
+// carries a good signature, or, if AllowSignedCommits is set, if the
+// revision itself does.
+//
+// Both GPG and SSH signatures are understood. Only Git supports signing;
+// repositories of other kinds that match a rule fail verification.
+type SignatureRule struct {
+	// Pattern is a comma-separated list of glob patterns, as in GOPRIVATE,
+	// matched against import path prefixes: "github.com/tilt-dev" covers
+	// every repository of that org, "*.corp.example.com" every repository
+	// on those hosts.
+	Pattern string
+
+	// AllowedSigners is the SSH allowed signers file that lists the keys
+	// trusted to sign, as for git's gpg.ssh.allowedSignersFile.
+	// Without it, no SSH signature is trusted.
+	AllowedSigners string
+
+	// GPGHome is the GnuPG home directory whose keyring holds the keys
+	// trusted to sign. Defaults to the user's own keyring. Only keys the
+	// keyring trusts fully or ultimately are accepted, such as its own
+	// or those signed by them; merely imported keys are not.
+	GPGHome string
+
+	// AllowSignedCommits accepts a signed commit when no tag of the
+	// checked-out revision is signed.
+	AllowSignedCommits bool
+}
+
+// A SignatureResult describes the signature that satisfied a SignatureRule.
+type SignatureResult struct {
+	Ref    string // the tag that was verified, or "HEAD" for a commit
+	Object string // "tag" or "commit"
+	Format string // "gpg" or "ssh"
+	Signer string // the SSH principal or GPG user ID of the signer
+	Key    string // fingerprint of the signing key
+}
+
+// A DownloadResult describes the outcome of a download or sync.
+type DownloadResult struct {
+	Path string // directory of the package
+
+	// Signature is the verified signature of the checkout,
+	// or nil if no SignatureRule applies to the package.
+	Signature *SignatureResult
+}
+
+// A SignatureError reports that a checkout fails its SignatureRule.
+// It matches ErrUnsigned or ErrUntrustedSignature with errors.Is.
+type SignatureError struct {
+	Path   string // import path of the package
+	Ref    string // tag or revision that was checked
+	Kind   error  // ErrUnsigned or ErrUntrustedSignature
+	Detail string // output of the failed verification, if any
+}
+
+func (e *SignatureError) Error() string {
+	msg := fmt.Sprintf("%s: %s %v", e.Path, e.Ref, e.Kind)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Is reports whether target is the kind of failure e describes.
+func (e *SignatureError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *SignatureError) ImportPath() string {
+	return e.Path
+}
+
+// signatureRule returns the first of the Downloader's rules matching
+// the repository root, or nil if none does.
+func (d *Downloader) signatureRule(root string) *SignatureRule {
+	for i := range d.Signatures {
+		if module.MatchPrefixPatterns(d.Signatures[i].Pattern, root) {
+			return &d.Signatures[i]
+		}
+	}
+	return nil
+}
+
+// verifySignature checks the checkout at dir of the repository rooted at
+// import path rootPath against the SignatureRule for it, trying ref first
+// if it names a tag. It returns nil, nil if no rule applies.
+func (d *Downloader) verifySignature(ctx cmdContext, vcs *vcsCmd, rootPath, dir, ref string) (*SignatureResult, error) {
+	rule := d.signatureRule(rootPath)
+	if rule == nil {
+		return nil, nil
+	}
+	if vcs.verifyTagCmd == "" {
+		return nil, &SignatureError{Path: ctx.importPath, Ref: ref, Kind: ErrUnsigned,
+			Detail: "signatures not supported for " + vcs.name}
+	}
+	ctx = ctx.withDir(dir)
+	if rule.GPGHome != "" {
+		ctx.env = append(append([]string{}, ctx.env...), "GNUPGHOME="+rule.GPGHome)
+	}
+
+	out, err := vcs.runOutput(ctx, vcs.headTagsCmd)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, tag := range strings.Fields(string(out)) {
+		if tag == ref {
+			tags = append([]string{tag}, tags...)
+		} else {
+			tags = append(tags, tag)
+		}
+	}
+
+	var failure *SignatureError
+	for _, tag := range tags {
+		res, serr := verifySignatureCmd(ctx, vcs, vcs.verifyTagCmd, rule, tag)
+		if serr == nil {
+			res.Ref, res.Object = tag, "tag"
+			return res, nil
+		}
+		ctx.log(LevelDebug, "tag signature rejected", "tag", tag, "error", serr)
+		failure = worse(failure, serr)
+	}
+	if rule.AllowSignedCommits {
+		res, serr := verifySignatureCmd(ctx, vcs, vcs.verifyCommitCmd, rule, "HEAD")
+		if serr == nil {
+			res.Ref, res.Object = "HEAD", "commit"
+			return res, nil
+		}
+		ctx.log(LevelDebug, "commit signature rejected", "error", serr)
+		failure = worse(failure, serr)
+	}
+	if failure == nil {
+		if ref == "" {
+			ref = "HEAD"
+		}
+		failure = &SignatureError{Path: ctx.importPath, Ref: ref, Kind: ErrUnsigned, Detail: "no tags"}
+	}
+	return nil, failure
+}
+
+// worse returns the more serious of two failures, preferring a:
+// a bad or untrusted signature matters more than a missing one.
+func worse(a, b *SignatureError) *SignatureError {
+	if a == nil || b.Kind == ErrUntrustedSignature && a.Kind != ErrUntrustedSignature {
+		return b
+	}
+	return a
+}
+
+var (
+	sshGoodSigRe  = regexp.MustCompile(`Good "git" signature for (.+) with \S+ key (\S+)`)
+	gpgGoodSigRe  = regexp.MustCompile(`(?m)^\[GNUPG:\] GOODSIG \S+ (.*)$`)
+	gpgValidSigRe = regexp.MustCompile(`(?m)^\[GNUPG:\] VALIDSIG (\S+)`)
+	gpgTrustRe    = regexp.MustCompile(`(?m)^\[GNUPG:\] TRUST_([A-Z]+)`)
+)
+
+// verifySignatureCmd runs one of vcs's signature verification commands
+// on ref and parses the signer from its output.
+func verifySignatureCmd(ctx cmdContext, vcs *vcsCmd, cmd string, rule *SignatureRule, ref string) (*SignatureResult, *SignatureError) {
+	var stderr bytes.Buffer
+	ctx.stderr = &stderr
+	_, err := vcs.run1(ctx, cmd, []string{"signers", rule.AllowedSigners, "tag", ref}, false)
+	out := stderr.String()
+	if err == nil {
+		if m := sshGoodSigRe.FindStringSubmatch(out); m != nil {
+			return &SignatureResult{Format: "ssh", Signer: m[1], Key: m[2]}, nil
+		}
+		if m := gpgGoodSigRe.FindStringSubmatch(out); m != nil {
+			// A good signature only says the key made it; the key
+			// must also be trusted.
+			trust := "UNDEFINED"
+			if t := gpgTrustRe.FindStringSubmatch(out); t != nil {
+				trust = t[1]
+			}
+			if trust != "FULLY" && trust != "ULTIMATE" {
+				return nil, &SignatureError{Path: ctx.importPath, Ref: ref, Kind: ErrUntrustedSignature,
+					Detail: fmt.Sprintf("key of %s has %s trust", m[1], strings.ToLower(trust))}
+			}
+			res := &SignatureResult{Format: "gpg", Signer: m[1]}
+			if m := gpgValidSigRe.FindStringSubmatch(out); m != nil {
+				res.Key = m[1]
+			}
+			return res, nil
+		}
+	}
+
+	serr := &SignatureError{Path: ctx.importPath, Ref: ref, Kind: ErrUntrustedSignature}
+	lower := strings.ToLower(out)
+	if strings.Contains(lower, "no signature found") || strings.Contains(lower, "cannot verify a non-tag object") {
+		serr.Kind = ErrUnsigned
+	} else if out = strings.TrimSpace(out); out != "" {
+		serr.Detail = lastLine([]byte(out))
+	} else if err != nil {
+		serr.Detail = err.Error()
+	}
+	return nil, serr
+}
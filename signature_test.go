@@ -0,0 +1,220 @@
+package get
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sigTestRoot = "github.com/tilt-dev/sig-test"
+
+// sshKey generates an SSH signing key in dir, returning the path of the
+// private key and an allowed signers file that trusts it for principal.
+func sshKey(t *testing.T, dir, principal string) (key, allowedSigners string) {
+	t.Helper()
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	key = filepath.Join(dir, principal)
+	out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", principal, "-f", key).CombinedOutput()
+	require.NoError(t, err, "%s", out)
+	pub := readFile(t, key+".pub")
+	allowedSigners = key + ".allowed"
+	require.NoError(t, ioutil.WriteFile(allowedSigners, []byte(principal+" "+pub), 0644))
+	return key, allowedSigners
+}
+
+// sshSign runs a git command that signs with the SSH key.
+func sshSign(t *testing.T, dir, key string, args ...string) {
+	t.Helper()
+	runGit(t, dir, append([]string{"-c", "gpg.format=ssh", "-c", "user.signingkey=" + key}, args...)...)
+}
+
+func TestSignatureSSHTag(t *testing.T) {
+	keys := tmpdir(t)
+	alice, aliceSigners := sshKey(t, keys, "alice@example.com")
+	_, bobSigners := sshKey(t, keys, "bob@example.com")
+
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	sshSign(t, repo, alice, "tag", "-s", "v1", "-m", "v1")
+	gitCommit(t, repo, map[string]string{"Tiltfile": "v2"})
+	runGit(t, repo, "tag", "v2")
+	gitCommit(t, repo, map[string]string{"Tiltfile": "v3"})
+	runGit(t, repo, "tag", "-a", "v3", "-m", "v3")
+
+	srcRoot := setupDir(t)
+	cloneInto(t, srcRoot, sigTestRoot, repo)
+	d := NewDownloader(srcRoot)
+	d.Signatures = []SignatureRule{{Pattern: "github.com/tilt-dev", AllowedSigners: aliceSigners}}
+
+	res, err := d.RefSyncWithResult(sigTestRoot, "v1")
+	require.NoError(t, err)
+	require.NotNil(t, res.Signature)
+	assert.Equal(t, "v1", res.Signature.Ref)
+	assert.Equal(t, "tag", res.Signature.Object)
+	assert.Equal(t, "ssh", res.Signature.Format)
+	assert.Equal(t, "alice@example.com", res.Signature.Signer)
+	assert.Regexp(t, `^SHA256:`, res.Signature.Key)
+
+	checkout := filepath.Join(srcRoot, sigTestRoot)
+	for _, tag := range []string{"v2", "v3"} {
+		err = d.RefSync(sigTestRoot, tag)
+		assert.True(t, errors.Is(err, ErrUnsigned), "%s: %v", tag, err)
+		var serr *SignatureError
+		if assert.True(t, errors.As(err, &serr)) {
+			assert.Equal(t, sigTestRoot, serr.Path)
+			assert.Equal(t, tag, serr.Ref)
+		}
+		// The rejected tag is neither left checked out nor recorded.
+		assert.Equal(t, "v1", readFile(t, filepath.Join(checkout, "Tiltfile")), tag)
+		assert.Equal(t, "v1", d.query(sigTestRoot, runGit(t, checkout, "rev-parse", "HEAD")), tag)
+	}
+
+	d.Signatures[0].AllowedSigners = bobSigners
+	err = d.RefSync(sigTestRoot, "v1")
+	assert.True(t, errors.Is(err, ErrUntrustedSignature), "%v", err)
+	assert.Contains(t, err.Error(), "No principal matched")
+
+	// Repositories no rule matches aren't checked.
+	d.Signatures[0].Pattern = "github.com/other-org,gitlab.com"
+	res, err = d.RefSyncWithResult(sigTestRoot, "v2")
+	require.NoError(t, err)
+	assert.Nil(t, res.Signature)
+}
+
+func TestSignatureSSHCommit(t *testing.T) {
+	alice, signers := sshKey(t, tmpdir(t), "alice@example.com")
+	repo := gitRepo(t, nil)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repo, "Tiltfile"), []byte("v1"), 0644))
+	runGit(t, repo, "add", "Tiltfile")
+	sshSign(t, repo, alice, "commit", "-q", "-S", "-m", "signed")
+	branch := runGit(t, repo, "rev-parse", "--abbrev-ref", "HEAD")
+
+	srcRoot := setupDir(t)
+	cloneInto(t, srcRoot, sigTestRoot, repo)
+	d := NewDownloader(srcRoot)
+	d.Signatures = []SignatureRule{{Pattern: sigTestRoot, AllowedSigners: signers}}
+
+	err := d.RefSync(sigTestRoot, branch)
+	assert.True(t, errors.Is(err, ErrUnsigned), "%v", err)
+
+	d.Signatures[0].AllowSignedCommits = true
+	res, err := d.RefSyncWithResult(sigTestRoot, branch)
+	require.NoError(t, err)
+	require.NotNil(t, res.Signature)
+	assert.Equal(t, "commit", res.Signature.Object)
+	assert.Equal(t, "alice@example.com", res.Signature.Signer)
+}
+
+func TestSignatureGPG(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not installed")
+	}
+	gpgHome := tmpdir(t)
+	require.NoError(t, os.Chmod(gpgHome, 0700))
+	setenv(t, "GNUPGHOME", gpgHome)
+	t.Cleanup(func() {
+		_ = exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+	})
+	// The keyring trusts its own keys ultimately; Carol's is then made
+	// one it merely holds.
+	for _, uid := range []string{"Bob <bob@example.com>", "Carol <carol@example.com>"} {
+		out, err := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key",
+			uid, "ed25519", "sign", "never").CombinedOutput()
+		require.NoError(t, err, "%s", out)
+	}
+	out, err := exec.Command("gpg", "--batch", "--with-colons", "--fingerprint", "carol@example.com").Output()
+	require.NoError(t, err)
+	fpr := regexp.MustCompile(`(?m)^fpr:+([0-9A-F]+):`).FindStringSubmatch(string(out))
+	require.NotNil(t, fpr, "%s", out)
+	trust := exec.Command("gpg", "--batch", "--import-ownertrust")
+	trust.Stdin = strings.NewReader(fpr[1] + ":2:\n")
+	out, err = trust.CombinedOutput()
+	require.NoError(t, err, "%s", out)
+
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	runGit(t, repo, "-c", "user.signingkey=bob@example.com", "tag", "-s", "v1", "-m", "v1")
+	gitCommit(t, repo, map[string]string{"Tiltfile": "v2"})
+	runGit(t, repo, "-c", "user.signingkey=carol@example.com", "tag", "-s", "v2", "-m", "v2")
+
+	srcRoot := setupDir(t)
+	cloneInto(t, srcRoot, sigTestRoot, repo)
+	d := NewDownloader(srcRoot)
+	d.Signatures = []SignatureRule{{Pattern: sigTestRoot, GPGHome: gpgHome}}
+
+	res, err := d.RefSyncWithResult(sigTestRoot, "v1")
+	require.NoError(t, err)
+	require.NotNil(t, res.Signature)
+	assert.Equal(t, "gpg", res.Signature.Format)
+	assert.Equal(t, "Bob <bob@example.com>", res.Signature.Signer)
+	assert.Regexp(t, `^[0-9A-F]{40}$`, res.Signature.Key)
+
+	// A good signature by a key the keyring holds but doesn't trust
+	// is rejected.
+	err = d.RefSync(sigTestRoot, "v2")
+	assert.True(t, errors.Is(err, ErrUntrustedSignature), "%v", err)
+	assert.Contains(t, fmt.Sprint(err), "key of Carol <carol@example.com> has undefined trust")
+
+	// A keyring without Bob's key doesn't trust his signature.
+	d.Signatures[0].GPGHome = tmpdir(t)
+	err = d.RefSync(sigTestRoot, "v1")
+	assert.True(t, errors.Is(err, ErrUntrustedSignature), "%v", err)
+}
+
+func TestSignatureUnsupportedVCS(t *testing.T) {
+	d := NewDownloader(setupDir(t))
+	d.Signatures = []SignatureRule{{Pattern: sigTestRoot}}
+	ctx := d.toCmdContext(sigTestRoot, ".")
+	_, err := d.verifySignature(ctx, vcsHg, sigTestRoot, ".", "v1")
+	assert.True(t, errors.Is(err, ErrUnsigned), "%v", err)
+	var serr *SignatureError
+	if assert.True(t, errors.As(err, &serr)) {
+		assert.Equal(t, "signatures not supported for Mercurial", serr.Detail)
+	}
+}
+
+func TestDownloadSignature(t *testing.T) {
+	alice, signers := sshKey(t, tmpdir(t), "alice@example.com")
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	srcRoot := setupDir(t)
+	cloneInto(t, srcRoot, sigTestRoot, repo)
+
+	d := NewDownloader(srcRoot)
+	d.Signatures = []SignatureRule{{Pattern: "github.com", AllowedSigners: signers}}
+	_, err := d.Download(sigTestRoot)
+	assert.True(t, errors.Is(err, ErrUnsigned), "%v", err)
+
+	gitCommit(t, repo, map[string]string{"Tiltfile": "v2"})
+	sshSign(t, repo, alice, "tag", "-s", "v2", "-m", "v2")
+	res, err := d.DownloadWithResult(sigTestRoot)
+	require.NoError(t, err)
+	assert.Equal(t, d.DestinationPath(sigTestRoot), res.Path)
+	require.NotNil(t, res.Signature)
+	assert.Equal(t, "v2", res.Signature.Ref)
+
+	// An unsigned update is undone, leaving the branch where it was,
+	// so that a later signed update still fast-forwards.
+	checkout := filepath.Join(srcRoot, sigTestRoot)
+	branch := runGit(t, checkout, "symbolic-ref", "--short", "HEAD")
+	gitCommit(t, repo, map[string]string{"Tiltfile": "v3"})
+	_, err = d.Download(sigTestRoot)
+	assert.True(t, errors.Is(err, ErrUnsigned), "%v", err)
+	assert.Equal(t, "v2", readFile(t, filepath.Join(checkout, "Tiltfile")))
+	assert.Equal(t, branch, runGit(t, checkout, "symbolic-ref", "--short", "HEAD"))
+
+	sshSign(t, repo, alice, "tag", "-s", "v3", "-m", "v3")
+	res, err = d.DownloadWithResult(sigTestRoot)
+	require.NoError(t, err)
+	assert.Equal(t, "v3", readFile(t, filepath.Join(checkout, "Tiltfile")))
+	require.NotNil(t, res.Signature)
+	assert.Equal(t, "v3", res.Signature.Ref)
+}
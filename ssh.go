@@ -0,0 +1,167 @@
+package get
+
+import (
+	urlpkg "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tilt-dev/go-get/internal/module"
+)
+
+// An SSHRule configures ssh for the repositories matching a pattern,
+// such as to use a different deploy key for each organization.
+//
+// Git is given the options through GIT_SSH_COMMAND, and Mercurial
+// through its ui.ssh setting, for each command that talks to a matching
+// repository. They are added to the ssh command git would otherwise
+// run, see Environment.SSHCommand, ahead of its own options, which ssh
+// gives way to.
+type SSHRule struct {
+	// Pattern is a comma-separated list of glob patterns, as in GOPRIVATE,
+	// matched against the host and path of SSH repository URLs:
+	// "github.com/org-a" covers every repository of that organization,
+	// "gitlab.corp" every repository on that host.
+	Pattern string
+
+	// IdentityFile is the private key to authenticate with. Only it is
+	// offered, not the keys of the user's agent or ssh configuration.
+	IdentityFile string
+
+	// KnownHostsFile is the known_hosts file holding the host keys to
+	// trust, instead of the user's.
+	KnownHostsFile string
+
+	// Port and User are used for repository URLs that don't give their own.
+	Port int
+	User string
+
+	// HostKeyChecking is ssh's StrictHostKeyChecking setting.
+	// Defaults to "yes": a host whose key isn't known is refused.
+	// "accept-new" trusts and records the key of a host seen for the
+	// first time.
+	HostKeyChecking string
+}
+
+// An sshAddr is the address of a repository reached over ssh.
+type sshAddr struct {
+	user, host, port, path string
+}
+
+// sshSCPRe matches SCP-like addresses, as scpSyntaxRe does,
+// with or without a user.
+var sshSCPRe = regexp.MustCompile(`^(?:([a-zA-Z0-9_]+)@)?([a-zA-Z0-9._-]+):(.*)$`)
+
+// parseSSHRepo parses repo if it is an ssh URL or an SCP-like address.
+func parseSSHRepo(repo string) (sshAddr, bool) {
+	if !strings.Contains(repo, "://") {
+		// A single letter before the colon is a Windows drive, as git sees it.
+		if m := sshSCPRe.FindStringSubmatch(repo); m != nil && len(m[2]) > 1 {
+			return sshAddr{user: m[1], host: m[2], path: m[3]}, true
+		}
+		return sshAddr{}, false
+	}
+	u, err := urlpkg.Parse(repo)
+	if err != nil || (u.Scheme != "ssh" && u.Scheme != "git+ssh") {
+		return sshAddr{}, false
+	}
+	return sshAddr{user: u.User.Username(), host: u.Hostname(), port: u.Port(), path: u.Path}, true
+}
+
+// sshRule returns the first of the rules matching addr, or nil.
+func sshRule(rules []SSHRule, addr sshAddr) *SSHRule {
+	target := addr.host + "/" + strings.TrimPrefix(addr.path, "/")
+	for i := range rules {
+		if module.MatchPrefixPatterns(rules[i].Pattern, target) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// command returns base, an ssh command line, with r's options for
+// connecting to addr inserted after the program name.
+func (r *SSHRule) command(base string, addr sshAddr) string {
+	prog, rest := splitProgram(base)
+	opts := []string{prog}
+	if r.IdentityFile != "" {
+		opts = append(opts, "-i", shellQuote(r.IdentityFile), "-o", "IdentitiesOnly=yes")
+	}
+	if r.KnownHostsFile != "" {
+		// ssh splits the value into several files at spaces
+		// unless it is quoted.
+		opts = append(opts, "-o", shellQuote(`UserKnownHostsFile="`+r.KnownHostsFile+`"`))
+	}
+	if r.Port != 0 && addr.port == "" {
+		opts = append(opts, "-p", strconv.Itoa(r.Port))
+	}
+	if r.User != "" && addr.user == "" {
+		opts = append(opts, "-l", shellQuote(r.User))
+	}
+	checking := r.HostKeyChecking
+	if checking == "" {
+		checking = "yes"
+	}
+	opts = append(opts, "-o", "StrictHostKeyChecking="+shellQuote(checking))
+	if rest != "" {
+		opts = append(opts, rest)
+	}
+	return strings.Join(opts, " ")
+}
+
+// splitProgram splits a shell command line into the program, which may
+// be quoted, and the rest.
+func splitProgram(cmdline string) (prog, rest string) {
+	cmdline = strings.TrimSpace(cmdline)
+	i := 0
+	for i < len(cmdline) && cmdline[i] != ' ' && cmdline[i] != '\t' {
+		switch cmdline[i] {
+		case '\'', '"':
+			if j := strings.IndexByte(cmdline[i+1:], cmdline[i]); j >= 0 {
+				i += j + 1
+			}
+		case '\\':
+			i++
+		}
+		i++
+	}
+	if i > len(cmdline) {
+		i = len(cmdline)
+	}
+	return cmdline[:i], strings.TrimSpace(cmdline[i:])
+}
+
+// sshOptions returns args and the extra environment for running v on
+// repo with the options of the SSH rule for it, if any. env is the rest
+// of the command's environment, which gives the ssh command to extend.
+func (ctx cmdContext) sshOptions(v *vcsCmd, env []string, repo string, args []string) ([]string, []string) {
+	if len(ctx.ssh) == 0 || repo == "" {
+		return args, nil
+	}
+	addr, ok := parseSSHRepo(repo)
+	if !ok {
+		return args, nil
+	}
+	r := sshRule(ctx.ssh, addr)
+	if r == nil {
+		return args, nil
+	}
+	// The environment names the command unless the process environment
+	// sets GIT_SSH, which is a program rather than a command line.
+	base := lookupEnv(env, "GIT_SSH_COMMAND")
+	if base == "" {
+		base = shellQuote(lookupEnv(env, "GIT_SSH"))
+	}
+	switch v.cmd {
+	case "git":
+		return args, []string{"GIT_SSH_COMMAND=" + r.command(base, addr)}
+	case "hg":
+		return append([]string{"--config", "ui.ssh=" + r.command(base, addr)}, args...), nil
+	}
+	return args, nil
+}
+
+// shellQuote quotes s for the shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,131 @@
+package get
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSSHRepo(t *testing.T) {
+	for _, tt := range []struct {
+		repo string
+		want sshAddr
+		ok   bool
+	}{
+		{"git@github.com:org-a/repo.git", sshAddr{user: "git", host: "github.com", path: "org-a/repo.git"}, true},
+		{"ssh://gitlab.corp:2222/team/repo", sshAddr{host: "gitlab.corp", port: "2222", path: "/team/repo"}, true},
+		{"git+ssh://bob@example.com/repo", sshAddr{user: "bob", host: "example.com", path: "/repo"}, true},
+		{"https://github.com/org-a/repo", sshAddr{}, false},
+		{"gitlab.corp:team/repo", sshAddr{host: "gitlab.corp", path: "team/repo"}, true},
+		{"/local/path", sshAddr{}, false},
+		{"c:/local/path", sshAddr{}, false},
+	} {
+		addr, ok := parseSSHRepo(tt.repo)
+		assert.Equal(t, tt.ok, ok, tt.repo)
+		assert.Equal(t, tt.want, addr, tt.repo)
+	}
+}
+
+func TestSSHRuleCommand(t *testing.T) {
+	r := &SSHRule{
+		IdentityFile:   "/keys/deploy key",
+		KnownHostsFile: "/keys/known_hosts",
+		Port:           2222,
+		User:           "git",
+	}
+	assert.Equal(t,
+		`ssh -i '/keys/deploy key' -o IdentitiesOnly=yes -o 'UserKnownHostsFile="/keys/known_hosts"' -p 2222 -l 'git' -o StrictHostKeyChecking='yes' -o BatchMode=yes`,
+		r.command("ssh -o BatchMode=yes", sshAddr{host: "gitlab.corp"}))
+
+	// The repository's own port and user win, and the program may be quoted.
+	r = &SSHRule{Port: 2222, User: "git", HostKeyChecking: "accept-new"}
+	assert.Equal(t,
+		`'/opt/my ssh' -o StrictHostKeyChecking='accept-new'`,
+		r.command(`'/opt/my ssh'`, sshAddr{user: "bob", host: "gitlab.corp", port: "22"}))
+}
+
+func TestSSHOptions(t *testing.T) {
+	rules := []SSHRule{
+		{Pattern: "github.com/org-a", IdentityFile: "/keys/a"},
+		{Pattern: "gitlab.corp", IdentityFile: "/keys/b"},
+	}
+	ctx := newCmdContext(".", nil)
+	ctx.ssh = rules
+	env := []string{"GIT_SSH_COMMAND=ssh -o BatchMode=yes"}
+
+	args, extra := ctx.sshOptions(vcsGit, env, "git@github.com:org-a/repo.git", []string{"fetch"})
+	assert.Equal(t, []string{"fetch"}, args)
+	assert.Equal(t, []string{"GIT_SSH_COMMAND=ssh -i '/keys/a' -o IdentitiesOnly=yes -o StrictHostKeyChecking='yes' -o BatchMode=yes"}, extra)
+
+	args, extra = ctx.sshOptions(vcsHg, env, "ssh://hg@gitlab.corp/repo", []string{"pull"})
+	assert.Equal(t, []string{"--config", "ui.ssh=ssh -i '/keys/b' -o IdentitiesOnly=yes -o StrictHostKeyChecking='yes' -o BatchMode=yes", "pull"}, args)
+	assert.Nil(t, extra)
+
+	// Other repositories, and other schemes, are left alone.
+	for _, repo := range []string{"git@github.com:org-b/repo.git", "https://gitlab.corp/repo", ""} {
+		args, extra = ctx.sshOptions(vcsGit, env, repo, []string{"fetch"})
+		assert.Equal(t, []string{"fetch"}, args, repo)
+		assert.Nil(t, extra, repo)
+	}
+}
+
+func TestSSHRulesGit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	dir := tmpdir(t)
+	log := filepath.Join(dir, "ssh.log")
+	ssh := filepath.Join(dir, "ssh")
+	require.NoError(t, ioutil.WriteFile(ssh, []byte("#!/bin/sh\necho \"$@\" >> '"+log+"'\nexit 1\n"), 0755))
+
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1"})
+	d := NewDownloader(setupDir(t))
+	d.Env.SSHCommand = ssh + " -o BatchMode=yes"
+	d.SSH = []SSHRule{
+		{Pattern: "github.com/org-a", IdentityFile: "/keys/a"},
+		{Pattern: "gitlab.corp", IdentityFile: "/keys/b", Port: 2222, User: "git", HostKeyChecking: "accept-new"},
+	}
+
+	require.Error(t, installFromURL(t, d, "ssh://github.com/org-a/repo", repo))
+	require.Error(t, installFromURL(t, d, "gitlab.corp:team/repo", repo))
+	require.Error(t, installFromURL(t, d, "ssh://me@gitlab.corp/team/repo", repo))
+	require.Error(t, installFromURL(t, d, "ssh://github.com/org-b/repo", repo))
+
+	lines := strings.Split(strings.TrimSpace(readFile(t, log)), "\n")
+	require.Len(t, lines, 4)
+	assert.Contains(t, lines[0], "-i /keys/a -o IdentitiesOnly=yes -o StrictHostKeyChecking=yes -o BatchMode=yes")
+	assert.Contains(t, lines[0], "github.com")
+	// The rule's user and port are only used when the address has none.
+	assert.Contains(t, lines[1], "-i /keys/b -o IdentitiesOnly=yes -p 2222 -l git -o StrictHostKeyChecking=accept-new")
+	assert.Contains(t, lines[2], "-i /keys/b -o IdentitiesOnly=yes -p 2222 -o StrictHostKeyChecking=accept-new")
+	assert.NotContains(t, lines[2], "-l git")
+	assert.NotContains(t, lines[3], "-i")
+}
+
+func TestSSHRulesPing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	dir := tmpdir(t)
+	log := filepath.Join(dir, "ssh.log")
+	ssh := filepath.Join(dir, "ssh")
+	require.NoError(t, ioutil.WriteFile(ssh, []byte("#!/bin/sh\necho \"$@\" >> '"+log+"'\nexit 1\n"), 0755))
+
+	d := NewDownloader(setupDir(t))
+	d.Env.SSHCommand = ssh
+	d.SSH = []SSHRule{{Pattern: "gitlab.corp", IdentityFile: "/keys/b"}}
+
+	// Probing a schemeless path pings without the scheme in the repo.
+	ctx := d.toCmdContext("gitlab.corp/team/repo.git", ".")
+	require.Error(t, vcsGit.ping(ctx, "ssh", "gitlab.corp/team/repo"))
+
+	lines := strings.Split(strings.TrimSpace(readFile(t, log)), "\n")
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "-i /keys/b -o IdentitiesOnly=yes -o StrictHostKeyChecking=yes")
+	assert.Contains(t, lines[0], "gitlab.corp")
+}
@@ -0,0 +1,212 @@
+package get
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Status describes the local changes in a repository checkout.
+// Paths are slash-separated and relative to the repository root.
+type Status struct {
+	Modified  []string // tracked files with uncommitted changes
+	Untracked []string // files the VCS doesn't know about
+	Unpushed  []string // local commits missing from the remote, one summary line each
+}
+
+// Dirty reports whether the working tree has uncommitted changes,
+// which an update could carry onto another version or overwrite.
+// Unpushed commits don't make a tree dirty.
+func (s *Status) Dirty() bool {
+	return len(s.Modified) > 0 || len(s.Untracked) > 0
+}
+
+// A DirtyPolicy says what a Downloader does when asked to update
+// a checkout whose working tree is dirty.
+type DirtyPolicy int
+
+const (
+	// DirtyAllow updates anyway, leaving it to the VCS to merge
+	// or reject the local changes. This is the default.
+	DirtyAllow DirtyPolicy = iota
+
+	// DirtyRefuse fails the update with ErrDirtyWorkTree.
+	DirtyRefuse
+
+	// DirtyStash sets the local changes aside before updating
+	// and re-applies them afterwards.
+	DirtyStash
+
+	// DirtyDiscard throws the local changes away before updating.
+	DirtyDiscard
+)
+
+// status returns the local changes in the checkout at dir.
+func (v *vcsCmd) status(ctx cmdContext, dir string) (*Status, error) {
+	if v.statusCmd == "" {
+		return nil, fmt.Errorf("status not supported for %s", v.name)
+	}
+	cmdCtx := ctx.withDir(dir)
+	out, err := v.runOutput(cmdCtx, v.statusCmd)
+	if err != nil {
+		return nil, err
+	}
+	st := &Status{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		path, untracked := v.parseStatus(line)
+		if path == "" {
+			continue
+		}
+		if untracked {
+			st.Untracked = append(st.Untracked, filepath.ToSlash(path))
+		} else {
+			st.Modified = append(st.Modified, filepath.ToSlash(path))
+		}
+	}
+	if v.untrackedCmd != "" {
+		out, err := v.runOutput(cmdCtx, v.untrackedCmd)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				st.Untracked = append(st.Untracked, filepath.ToSlash(line))
+			}
+		}
+	}
+	if v.unpushedCmd != "" {
+		out, err := v.runOutput(cmdCtx, v.unpushedCmd)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				st.Unpushed = append(st.Unpushed, line)
+			}
+		}
+	}
+	return st, nil
+}
+
+// gitParseStatus parses a line of git status --porcelain:
+//
+//	XY path
+//	XY orig -> path
+func gitParseStatus(line string) (path string, untracked bool) {
+	if len(line) < 4 {
+		return "", false
+	}
+	path = line[3:]
+	if i := strings.Index(path, " -> "); i >= 0 {
+		path = path[i+len(" -> "):]
+	}
+	return strings.Trim(path, `"`), line[:2] == "??"
+}
+
+// hgParseStatus parses a line of hg status, such as "M path" or "? path".
+func hgParseStatus(line string) (path string, untracked bool) {
+	if len(line) < 3 {
+		return "", false
+	}
+	return line[2:], line[0] == '?'
+}
+
+// svnParseStatus parses a line of svn status, whose path
+// follows seven columns of status flags and a space.
+func svnParseStatus(line string) (path string, untracked bool) {
+	if len(line) < 9 || line[0] == ' ' && line[1] == ' ' {
+		// Only property or lock changes on other columns; or a summary line.
+		return "", false
+	}
+	if line[0] == 'X' {
+		// An unversioned directory created by an externals definition.
+		return "", false
+	}
+	return strings.TrimSpace(line[8:]), line[0] == '?'
+}
+
+// bzrParseStatus parses a line of bzr status --short,
+// whose path follows three columns of status flags and a space.
+func bzrParseStatus(line string) (path string, untracked bool) {
+	if len(line) < 5 {
+		return "", false
+	}
+	return strings.TrimSpace(line[4:]), line[0] == '?'
+}
+
+// fossilParseStatus parses a line of fossil changes, such as "EDITED     path".
+func fossilParseStatus(line string) (path string, untracked bool) {
+	f := strings.Fields(line)
+	if len(f) < 2 {
+		return "", false
+	}
+	return strings.TrimSpace(line[len(f[0]):]), false
+}
+
+// prepareUpdate applies the Downloader's DirtyPolicy to the checkout at dir
+// before an update. The returned function must be called after the update
+// to re-apply any changes that were set aside.
+func (d *Downloader) prepareUpdate(ctx cmdContext, vcs *vcsCmd, dir string) (restore func() error, err error) {
+	restore = func() error { return nil }
+	if d.DirtyPolicy == DirtyAllow {
+		return restore, nil
+	}
+	st, err := vcs.status(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	if !st.Dirty() {
+		return restore, nil
+	}
+
+	cmdCtx := ctx.withDir(dir)
+	switch d.DirtyPolicy {
+	case DirtyRefuse:
+		files := append(append([]string{}, st.Modified...), st.Untracked...)
+		return nil, &Error{Kind: ErrDirtyWorkTree, Err: fmt.Errorf("%s has local changes: %s", dir, summarizePaths(files))}
+
+	case DirtyStash:
+		if vcs.stashCmd == nil {
+			return nil, fmt.Errorf("cannot stash local changes in %s: not supported for %s", dir, vcs.name)
+		}
+		for _, cmd := range vcs.stashCmd {
+			if err := vcs.run(cmdCtx, cmd); err != nil {
+				return nil, err
+			}
+		}
+		ctx.log(LevelInfo, "stashed local changes", "dir", dir)
+		return func() error {
+			for _, cmd := range vcs.unstashCmd {
+				if err := vcs.run(cmdCtx, cmd); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, nil
+
+	case DirtyDiscard:
+		if vcs.discardCmd == nil {
+			return nil, fmt.Errorf("cannot discard local changes in %s: not supported for %s", dir, vcs.name)
+		}
+		for _, cmd := range vcs.discardCmd {
+			if err := vcs.run(cmdCtx, cmd); err != nil {
+				return nil, err
+			}
+		}
+		ctx.log(LevelWarn, "discarded local changes", "dir", dir)
+		return restore, nil
+	}
+	return nil, fmt.Errorf("unknown DirtyPolicy %d", d.DirtyPolicy)
+}
+
+// summarizePaths lists the first few paths, for error messages.
+func summarizePaths(paths []string) string {
+	const max = 5
+	if len(paths) <= max {
+		return strings.Join(paths, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(paths[:max], ", "), len(paths)-max)
+}
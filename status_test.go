@@ -0,0 +1,89 @@
+package get
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const statusTestPkg = "github.com/tilt-dev/status-test"
+
+// dirtyCheckout clones a repository with a v1 tag and a later commit
+// into srcRoot, then edits a tracked file and adds an untracked one.
+func dirtyCheckout(t *testing.T, srcRoot string) string {
+	t.Helper()
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1", "README.md": "v1"})
+	runGit(t, repo, "tag", "v1")
+	gitCommit(t, repo, map[string]string{"README.md": "v2"})
+
+	dir := cloneInto(t, srcRoot, statusTestPkg, repo)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "Tiltfile"), []byte("local"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "scratch.txt"), []byte("scratch"), 0644))
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestStatus(t *testing.T) {
+	srcRoot := setupDir(t)
+	dir := dirtyCheckout(t, srcRoot)
+	runGit(t, dir, "-c", "user.name=test", "-c", "user.email=test@example.com",
+		"commit", "-q", "--allow-empty", "-m", "local commit")
+
+	st, err := NewDownloader(srcRoot).Status(statusTestPkg)
+	require.NoError(t, err)
+	assert.True(t, st.Dirty())
+	assert.Equal(t, []string{"Tiltfile"}, st.Modified)
+	assert.Equal(t, []string{"scratch.txt"}, st.Untracked)
+	if assert.Len(t, st.Unpushed, 1) {
+		assert.Contains(t, st.Unpushed[0], "local commit")
+	}
+}
+
+func TestDirtyPolicy(t *testing.T) {
+	t.Run("refuse", func(t *testing.T) {
+		srcRoot := setupDir(t)
+		dir := dirtyCheckout(t, srcRoot)
+		d := NewDownloader(srcRoot)
+		d.DirtyPolicy = DirtyRefuse
+
+		err := d.RefSync(statusTestPkg, "v1")
+		assert.True(t, errors.Is(err, ErrDirtyWorkTree), "got %v", err)
+		assert.Contains(t, err.Error(), "Tiltfile, scratch.txt")
+		assert.Equal(t, "v2", readFile(t, filepath.Join(dir, "README.md")))
+	})
+
+	t.Run("stash", func(t *testing.T) {
+		srcRoot := setupDir(t)
+		dir := dirtyCheckout(t, srcRoot)
+		d := NewDownloader(srcRoot)
+		d.DirtyPolicy = DirtyStash
+
+		require.NoError(t, d.RefSync(statusTestPkg, "v1"))
+		assert.Equal(t, "v1", readFile(t, filepath.Join(dir, "README.md")))
+		assert.Equal(t, "local", readFile(t, filepath.Join(dir, "Tiltfile")))
+		assert.Equal(t, "scratch", readFile(t, filepath.Join(dir, "scratch.txt")))
+		assert.Empty(t, runGit(t, dir, "stash", "list"))
+	})
+
+	t.Run("discard", func(t *testing.T) {
+		srcRoot := setupDir(t)
+		dir := dirtyCheckout(t, srcRoot)
+		d := NewDownloader(srcRoot)
+		d.DirtyPolicy = DirtyDiscard
+
+		require.NoError(t, d.RefSync(statusTestPkg, "v1"))
+		assert.Equal(t, "v1", readFile(t, filepath.Join(dir, "README.md")))
+		assert.Equal(t, "v1", readFile(t, filepath.Join(dir, "Tiltfile")))
+		assert.NoFileExists(t, filepath.Join(dir, "scratch.txt"))
+	})
+}
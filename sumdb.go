@@ -0,0 +1,257 @@
+package get
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/tilt-dev/go-get/internal/sumdb"
+	"github.com/tilt-dev/go-get/internal/web"
+)
+
+// A SumDB configures verification of downloaded versions against a
+// checksum database, such as sum.golang.org.
+//
+// The database is a transparency log: the Downloader checks the signature
+// on the log's tree head, and the inclusion proof for each record it reads,
+// before trusting a checksum. Verified tiles and the latest tree head are
+// cached on disk, so later lookups only download what's new and a server
+// that rewrites its history is detected.
+type SumDB struct {
+	// Key is the database's verifier key, in the form
+	//
+	//	<name>+<hash>+<keydata>
+	//
+	// The name also locates the database when URL is empty.
+	Key string
+
+	// URL is the base URL of the database, or of a proxy for it.
+	// Defaults to https://<name>.
+	URL string
+
+	// NoSumDB is a comma-separated list of glob patterns, as in GONOSUMDB,
+	// matching import path prefixes that are not checked,
+	// such as private repositories the database can't see.
+	// Defaults to $GONOSUMDB, or $GOPRIVATE if that is unset.
+	NoSumDB string
+
+	// CacheDir holds the verified tiles and tree head.
+	// Defaults to .go-get-cache/sumdb in the Downloader's source root.
+	CacheDir string
+}
+
+// semverRe matches the versions the checksum database can record.
+var semverRe = regexp.MustCompile(`^v[0-9]+\.[0-9]+\.[0-9]+(-[^@]*)?(\+incompatible)?$`)
+
+// VerifySum checks the checkout of pkg's repository against the checksum
+// database's record for the repository root at the given version.
+// Assumes the repo has already been downloaded and synced to version.
+//
+// The checkout is hashed as by HashDir, so the check only passes for a
+// module at the root of its repository whose zip contains every file
+// in the checkout.
+//
+// VerifySum returns nil without checking when the Downloader has no SumDB
+// or the repository root matches its NoSumDB patterns.
+// If the checkout doesn't match, it returns a *ChecksumError.
+func (d *Downloader) VerifySum(pkg, version string) (err error) {
+	defer wrapError(pkg, &err)
+
+	if d.SumDB == nil {
+		return nil
+	}
+	_, rr, err := d.repoRoot(pkg)
+	if err != nil {
+		return err
+	}
+	root := filepath.Join(d.srcRoot, filepath.FromSlash(rr.Root))
+	ctx := d.toCmdContext(pkg, root)
+
+	client, err := d.sumdbClient()
+	if err != nil {
+		return err
+	}
+	lines, err := client.Lookup(rr.Root, version)
+	if errors.Is(err, sumdb.ErrGONOSUMDB) {
+		ctx.log(LevelDebug, "skipped checksum database", "root", rr.Root)
+		return nil
+	}
+	if errors.Is(err, sumdb.ErrSecurity) {
+		return &Error{Kind: ErrChecksumMismatch, Err: fmt.Errorf("checksum database: %v", err)}
+	}
+	if err != nil {
+		return fmt.Errorf("checksum database: %v", err)
+	}
+
+	// Each record has a line for the module and one for its go.mod.
+	prefix := rr.Root + " " + version + " "
+	want := ""
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			want = strings.TrimPrefix(line, prefix)
+		}
+	}
+	if want == "" {
+		return fmt.Errorf("checksum database: %s@%s: no checksum in record", rr.Root, version)
+	}
+
+	got, err := HashDir(root, rr.Root+"@"+version)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return &ChecksumError{Path: pkg, Want: want, Got: got}
+	}
+	ctx.log(LevelDebug, "verified checksum", "root", rr.Root, "version", version, "hash", got)
+	return nil
+}
+
+// sumdbClient returns the Downloader's checksum database client,
+// creating it on first use.
+func (d *Downloader) sumdbClient() (*sumdb.Client, error) {
+	if d.sumdb != nil {
+		return d.sumdb, nil
+	}
+	db := d.SumDB
+	name := db.Key
+	if i := strings.Index(name, "+"); i >= 0 {
+		name = name[:i]
+	}
+	if name == "" {
+		return nil, fmt.Errorf("invalid checksum database key %q", db.Key)
+	}
+	rawURL := db.URL
+	if rawURL == "" {
+		rawURL = "https://" + name
+	}
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checksum database URL: %v", err)
+	}
+	dir := db.CacheDir
+	if dir == "" {
+		dir = filepath.Join(d.srcRoot, ".go-get-cache", "sumdb")
+	}
+	noSumDB := db.NoSumDB
+	if noSumDB == "" {
+		noSumDB = os.Getenv("GONOSUMDB")
+	}
+	if noSumDB == "" {
+		noSumDB = os.Getenv("GOPRIVATE")
+	}
+
+	client := sumdb.NewClient(&sumdbOps{
+		ctx:  d.toCmdContext("", "."),
+		key:  db.Key,
+		base: base,
+		dir:  dir,
+	})
+	client.SetGONOSUMDB(noSumDB)
+	d.sumdb = client
+	return client, nil
+}
+
+// sumdbOps implements sumdb.ClientOps, fetching with internal/web
+// and keeping configuration and tiles under dir.
+type sumdbOps struct {
+	ctx  cmdContext
+	key  string
+	base *url.URL
+	dir  string
+
+	mu sync.Mutex // guards config writes
+}
+
+func (o *sumdbOps) ReadRemote(path string) ([]byte, error) {
+	u := web.Join(o.base, path)
+	var data []byte
+	err := o.ctx.retry("sumdb", func() error {
+		var err error
+		data, err = o.ctx.webClient().GetBytes(u)
+		return err
+	})
+	return data, err
+}
+
+func (o *sumdbOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(o.key), nil
+	}
+	data, err := ioutil.ReadFile(o.path("config", file))
+	if os.IsNotExist(err) {
+		// No tree head seen yet; the client starts from an empty tree.
+		return nil, nil
+	}
+	return data, err
+}
+
+func (o *sumdbOps) WriteConfig(file string, old, new []byte) error {
+	if file == "key" {
+		return fmt.Errorf("cannot write key")
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	path := o.path("config", file)
+	cur, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !bytes.Equal(cur, old) {
+		return sumdb.ErrWriteConflict
+	}
+	return writeFileAtomic(path, new)
+}
+
+func (o *sumdbOps) ReadCache(file string) ([]byte, error) {
+	return ioutil.ReadFile(o.path("cache", file))
+}
+
+func (o *sumdbOps) WriteCache(file string, data []byte) {
+	if err := writeFileAtomic(o.path("cache", file), data); err != nil {
+		o.ctx.log(LevelWarn, "caching checksum database tile", "file", file, "error", err)
+	}
+}
+
+func (o *sumdbOps) Log(msg string) {
+	o.ctx.log(LevelDebug, msg)
+}
+
+func (o *sumdbOps) SecurityError(msg string) {
+	o.ctx.log(LevelError, "checksum database security error", "msg", msg)
+}
+
+func (o *sumdbOps) path(kind, file string) string {
+	return filepath.Join(o.dir, kind, filepath.FromSlash(file))
+}
+
+// writeFileAtomic writes data to path through a temporary file,
+// so that readers never see a partial write.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+package get
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tilt-dev/go-get/internal/sumdb"
+	"github.com/tilt-dev/go-get/internal/sumdb/note"
+	"github.com/tilt-dev/go-get/internal/sumdb/sumdbtest"
+)
+
+const sumdbTestRoot = "github.com/tilt-dev/sumdb-test"
+
+// sumdbServer starts an in-process checksum database that records
+// the given hashes, keyed by path@version, and returns its config.
+func sumdbServer(t *testing.T, hashes map[string]string) *SumDB {
+	t.Helper()
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sum.test")
+	require.NoError(t, err)
+
+	ts := sumdbtest.NewTestServer(skey, func(path, vers string) ([]byte, error) {
+		h, ok := hashes[path+"@"+vers]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(fmt.Sprintf("%s %s %s\n%s %s/go.mod h1:unused=\n", path, vers, h, path, vers)), nil
+	})
+	srv := httptest.NewServer(sumdb.NewServer(ts))
+	t.Cleanup(srv.Close)
+	return &SumDB{Key: vkey, URL: srv.URL}
+}
+
+// sumdbTestRepo creates a repository tagged v1.0.0 and clones it into
+// srcRoot, returning the clone and its hash at v1.0.0.
+func sumdbTestRepo(t *testing.T, srcRoot string) (dir, hash string) {
+	t.Helper()
+	repo := gitRepo(t, map[string]string{"Tiltfile": "v1", "go.mod": "module " + sumdbTestRoot + "\n"})
+	runGit(t, repo, "tag", "v1.0.0")
+	gitCommit(t, repo, map[string]string{"Tiltfile": "v2"})
+	dir = cloneInto(t, srcRoot, sumdbTestRoot, repo)
+
+	branch := runGit(t, dir, "rev-parse", "--abbrev-ref", "HEAD")
+	runGit(t, dir, "checkout", "--quiet", "v1.0.0")
+	hash, err := HashDir(dir, sumdbTestRoot+"@v1.0.0")
+	require.NoError(t, err)
+	runGit(t, dir, "checkout", "--quiet", branch)
+	return dir, hash
+}
+
+func TestVerifySum(t *testing.T) {
+	srcRoot := setupDir(t)
+	dir, hash := sumdbTestRepo(t, srcRoot)
+
+	d := NewDownloader(srcRoot)
+	d.SumDB = sumdbServer(t, map[string]string{sumdbTestRoot + "@v1.0.0": hash})
+	require.NoError(t, d.RefSync(sumdbTestRoot, "v1.0.0"))
+
+	// The verified tree head is remembered for later lookups.
+	_, err := ioutil.ReadFile(filepath.Join(srcRoot, ".go-get-cache", "sumdb", "config", "sum.test", "latest"))
+	assert.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "Tiltfile"), []byte("tampered"), 0644))
+	err = d.VerifySum(sumdbTestRoot, "v1.0.0")
+	assert.True(t, errors.Is(err, ErrChecksumMismatch), "%v", err)
+	var cerr *ChecksumError
+	require.True(t, errors.As(err, &cerr))
+	assert.Equal(t, hash, cerr.Want)
+}
+
+func TestVerifySumMismatch(t *testing.T) {
+	srcRoot := setupDir(t)
+	dir, _ := sumdbTestRepo(t, srcRoot)
+	branch := runGit(t, dir, "rev-parse", "--abbrev-ref", "HEAD")
+
+	d := NewDownloader(srcRoot)
+	d.SumDB = sumdbServer(t, map[string]string{
+		sumdbTestRoot + "@v1.0.0": "h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",
+	})
+	err := d.RefSync(sumdbTestRoot, "v1.0.0")
+	assert.True(t, errors.Is(err, ErrChecksumMismatch), "%v", err)
+
+	// Branches and other refs that aren't semantic versions aren't checked.
+	assert.NoError(t, d.RefSync(sumdbTestRoot, branch))
+}
+
+func TestVerifySumNotFound(t *testing.T) {
+	srcRoot := setupDir(t)
+	sumdbTestRepo(t, srcRoot)
+
+	d := NewDownloader(srcRoot)
+	d.SumDB = sumdbServer(t, nil)
+	err := d.RefSync(sumdbTestRoot, "v1.0.0")
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, ErrChecksumMismatch), "%v", err)
+	assert.Contains(t, err.Error(), "404")
+
+	d = NewDownloader(srcRoot)
+	d.SumDB = sumdbServer(t, nil)
+	d.SumDB.NoSumDB = "github.com/tilt-dev"
+	assert.NoError(t, d.RefSync(sumdbTestRoot, "v1.0.0"))
+}
+
+func TestVerifySumWrongKey(t *testing.T) {
+	srcRoot := setupDir(t)
+	_, hash := sumdbTestRepo(t, srcRoot)
+
+	_, otherKey, err := note.GenerateKey(rand.Reader, "sum.test")
+	require.NoError(t, err)
+	d := NewDownloader(srcRoot)
+	d.SumDB = sumdbServer(t, map[string]string{sumdbTestRoot + "@v1.0.0": hash})
+	d.SumDB.Key = otherKey
+	err = d.VerifySum(sumdbTestRoot, "v1.0.0")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no verifiable signatures")
+}
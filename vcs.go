@@ -5,6 +5,7 @@
 package get
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,17 +16,52 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/tilt-dev/go-get/internal/web"
 )
 
 type cmdContext struct {
 	dir    string
-	stderr io.Writer
+	logger Logger // receives diagnostics; may be nil
+
+	importPath  string       // import path being resolved or downloaded, for events
+	observer    Observer     // receives progress events; may be nil
+	retryPolicy *RetryPolicy // retries transient network failures; may be nil
+
+	env    []string  // extra environment variables for commands
+	stderr io.Writer // also receives command stderr; may be nil
+
+	govcs   string // GOVCS setting; defaults to $GOVCS
+	private string // GOPRIVATE-style patterns; defaults to $GOPRIVATE
+
+	hardened    bool         // run commands with the VCS's safety overrides
+	environment Environment  // environment options for commands
+	interactive *Interactive // answers prompts from commands; may be nil
+
+	policy      *Policy            // checked before contacting a repository; may be nil
+	repo        string             // repository URL, for commands that don't name it
+	credentials CredentialProvider // credentials for HTTPS; may be nil
+	goAuth      *GoAuthCredentials // for HTTP requests when credentials is nil; may be nil
+	ssh         []SSHRule          // ssh options for repositories by pattern
+	http        *HTTPConfig        // HTTP connection settings; may be nil
+	httpCache   string             // directory of the HTTP cache; empty disables it
+}
+
+func newCmdContext(dir string, logger Logger) cmdContext {
+	return cmdContext{logger: logger, dir: dir}
+}
+
+// withDir returns a copy of ctx that runs commands in dir.
+func (ctx cmdContext) withDir(dir string) cmdContext {
+	ctx.dir = dir
+	return ctx
 }
 
-func newCmdContext(dir string, stderr io.Writer) cmdContext {
-	return cmdContext{stderr: stderr, dir: dir}
+// withRepo returns a copy of ctx whose commands talk to repo.
+func (ctx cmdContext) withRepo(repo string) cmdContext {
+	ctx.repo = repo
+	return ctx
 }
 
 // A vcsCmd describes how to use a version control system
@@ -45,6 +81,29 @@ type vcsCmd struct {
 	scheme  []string
 	pingCmd string
 
+	progressFlag string // flag substituted for {progress} when progress is observed
+
+	statusCmd    string                                          // command to list local changes
+	parseStatus  func(line string) (path string, untracked bool) // parses a line of statusCmd output
+	untrackedCmd string                                          // command to list untracked files, if statusCmd doesn't
+	unpushedCmd  string                                          // command to list local commits missing from the remote
+	stashCmd     []string                                        // commands to set local changes aside
+	unstashCmd   []string                                        // commands to re-apply changes set aside by stashCmd
+	discardCmd   []string                                        // commands to throw local changes away
+
+	revisionCmd    string   // command to print the checked-out revision
+	branchCmd      string   // command to print the checked-out branch; fails if there is none
+	rollbackCmd    []string // commands to move {branch} back to {rev} and check it out
+	fetchCmd       []string // commands to fetch updates without changing the working tree
+	hasRevisionCmd string   // command that fails or prints nothing unless the remote has {rev}
+
+	headTagsCmd     string // command to list the tags of the checked-out revision
+	verifyTagCmd    string // command to verify the signature on {tag}, trusting {signers}
+	verifyCommitCmd string // command to verify the signature on the checked-out revision
+
+	harden    func(args []string) []string // adds safety overrides to a command line in hardened mode
+	hardenEnv []string                     // environment for hardened mode
+
 	remoteRepo  func(v *vcsCmd, rootDir cmdContext) (remoteRepo string, err error)
 	resolveRepo func(v *vcsCmd, rootDir cmdContext, remoteRepo string) (realRepo string, err error)
 }
@@ -134,6 +193,21 @@ var vcsHg = &vcsCmd{
 	scheme:     []string{"https", "http", "ssh"},
 	pingCmd:    "identify -- {scheme}://{repo}",
 	remoteRepo: hgRemoteRepo,
+
+	statusCmd:   "status",
+	parseStatus: hgParseStatus,
+	unpushedCmd: `log -r draft() -T {node|short}\n`,
+
+	revisionCmd:    "log -r . -T {node}",
+	fetchCmd:       []string{"pull"},
+	hasRevisionCmd: "log -r {rev} -T {node}",
+
+	stashCmd:   []string{"--config extensions.shelve= shelve --unknown"},
+	unstashCmd: []string{"--config extensions.shelve= unshelve"},
+	discardCmd: []string{"revert --all --no-backup", "--config extensions.purge= purge"},
+
+	harden:    hgHarden,
+	hardenEnv: hgHardenEnv,
 }
 
 func hgRemoteRepo(vcsHg *vcsCmd, rootDir cmdContext) (remoteRepo string, err error) {
@@ -149,8 +223,8 @@ var vcsGit = &vcsCmd{
 	name: "Git",
 	cmd:  "git",
 
-	createCmd:   []string{"clone -- {repo} {dir}", "-go-internal-cd {dir} submodule update --init --recursive"},
-	downloadCmd: []string{"pull --ff-only", "submodule update --init --recursive"},
+	createCmd:   []string{"clone {progress} -- {repo} {dir}", "-go-internal-cd {dir} submodule update --init --recursive"},
+	downloadCmd: []string{"pull --ff-only {progress}", "submodule update --init --recursive"},
 
 	tagCmd: []tagCmd{
 		// tags/xxx matches a git tag named xxx
@@ -176,6 +250,37 @@ var vcsGit = &vcsCmd{
 	// See golang.org/issue/33836.
 	pingCmd: "ls-remote {scheme}://{repo}",
 
+	progressFlag: "--progress",
+
+	statusCmd:   "status --porcelain",
+	parseStatus: gitParseStatus,
+	unpushedCmd: "log --branches --not --remotes --oneline",
+
+	revisionCmd: "rev-parse HEAD",
+	branchCmd:   "symbolic-ref --quiet --short HEAD",
+	// reset --keep refuses to overwrite local changes that DirtyAllow
+	// left in place.
+	rollbackCmd: []string{"checkout {branch}", "reset --keep {rev}", "submodule update --init --recursive"},
+	fetchCmd:    []string{"fetch --tags --quiet origin"},
+	// Only count the revision as present if a remote branch or tag
+	// contains it, not merely if it's in the local object store.
+	hasRevisionCmd: "for-each-ref --count 1 --contains {rev} refs/remotes refs/tags",
+
+	// Setting the allowed signers file even when it's empty keeps
+	// the user's own git config from vouching for SSH keys.
+	headTagsCmd:     "tag --points-at HEAD",
+	verifyTagCmd:    "-c gpg.ssh.allowedSignersFile={signers} verify-tag --raw {tag}",
+	verifyCommitCmd: "-c gpg.ssh.allowedSignersFile={signers} verify-commit --raw HEAD",
+
+	// Stashing records a commit, which needs an identity even though
+	// nobody will see it.
+	stashCmd:   []string{"-c user.name=go-get -c user.email=go-get@localhost stash push --include-untracked --quiet"},
+	unstashCmd: []string{"stash pop --quiet"},
+	discardCmd: []string{"reset --hard --quiet", "clean -fd --quiet"},
+
+	harden:    gitHarden,
+	hardenEnv: gitHardenEnv,
+
 	remoteRepo: gitRemoteRepo,
 }
 
@@ -246,6 +351,14 @@ var vcsBzr = &vcsCmd{
 	pingCmd:     "info -- {scheme}://{repo}",
 	remoteRepo:  bzrRemoteRepo,
 	resolveRepo: bzrResolveRepo,
+
+	statusCmd:   "status --short",
+	parseStatus: bzrParseStatus,
+	stashCmd:    []string{"shelve --all"},
+	unstashCmd:  []string{"unshelve"},
+	discardCmd:  []string{"revert --no-backup", "clean-tree --unknown --force"},
+
+	harden: bzrHarden,
 }
 
 func bzrRemoteRepo(vcsBzr *vcsCmd, rootDir cmdContext) (remoteRepo string, err error) {
@@ -303,6 +416,12 @@ var vcsSvn = &vcsCmd{
 	scheme:     []string{"https", "http", "svn", "svn+ssh"},
 	pingCmd:    "info -- {scheme}://{repo}",
 	remoteRepo: svnRemoteRepo,
+
+	statusCmd:   "status",
+	parseStatus: svnParseStatus,
+	discardCmd:  []string{"revert -R .", "cleanup --remove-unversioned"},
+
+	harden: svnHarden,
 }
 
 func svnRemoteRepo(vcsSvn *vcsCmd, rootDir cmdContext) (remoteRepo string, err error) {
@@ -353,6 +472,13 @@ var vcsFossil = &vcsCmd{
 
 	scheme:     []string{"https", "http"},
 	remoteRepo: fossilRemoteRepo,
+
+	statusCmd:    "changes",
+	parseStatus:  fossilParseStatus,
+	untrackedCmd: "extras",
+	stashCmd:     []string{"stash save"},
+	unstashCmd:   []string{"stash pop"},
+	discardCmd:   []string{"revert", "clean --force"},
 }
 
 func fossilRemoteRepo(vcsFossil *vcsCmd, rootDir cmdContext) (remoteRepo string, err error) {
@@ -371,15 +497,15 @@ func (v *vcsCmd) String() string {
 // keyval is a list of key, value pairs. run expands
 // instances of {key} in cmd into value, but only after
 // splitting cmd into individual arguments.
-// If an error occurs, run prints the command line and the
-// command's combined stdout+stderr to standard error.
+// If an error occurs, run logs the command line and the
+// command's stderr at LevelError.
 // Otherwise run discards the command's output.
 func (v *vcsCmd) run(ctx cmdContext, cmd string, keyval ...string) error {
 	_, err := v.run1(ctx, cmd, keyval, true)
 	return err
 }
 
-// runVerboseOnly is like run but only generates error output to standard error in verbose mode.
+// runVerboseOnly is like run but only logs failures at LevelDebug.
 func (v *vcsCmd) runVerboseOnly(ctx cmdContext, cmd string, keyval ...string) error {
 	_, err := v.run1(ctx, cmd, keyval, false)
 	return err
@@ -397,9 +523,17 @@ func (v *vcsCmd) run1(ctx cmdContext, cmdline string, keyval []string, verbose b
 	for i := 0; i < len(keyval); i += 2 {
 		m[keyval[i]] = keyval[i+1]
 	}
-	args := strings.Fields(cmdline)
-	for i, arg := range args {
-		args[i] = expand(m, arg)
+	if ctx.observer != nil {
+		m["progress"] = v.progressFlag
+	}
+	var args []string
+	for _, arg := range strings.Fields(cmdline) {
+		// {progress} is optional: drop it entirely rather than
+		// passing an empty argument when nobody is watching.
+		if arg == "{progress}" && m["progress"] == "" {
+			continue
+		}
+		args = append(args, expand(m, arg))
 	}
 
 	if len(args) >= 2 && args[0] == "-go-internal-mkdir" {
@@ -410,7 +544,7 @@ func (v *vcsCmd) run1(ctx cmdContext, cmdline string, keyval []string, verbose b
 			err = os.Mkdir(filepath.Join(dir, args[1]), os.ModePerm)
 		}
 		if err != nil {
-			return nil, err
+			return nil, newError(ctx.importPath, "", err)
 		}
 		args = args[2:]
 	}
@@ -424,43 +558,110 @@ func (v *vcsCmd) run1(ctx cmdContext, cmdline string, keyval []string, verbose b
 		args = args[2:]
 	}
 
+	if ctx.hardened && v.harden != nil {
+		args = v.harden(args)
+	}
+
+	// While probing, the repo key lacks the scheme, which goes in a key
+	// of its own; the SSH rules and credentials need the whole URL.
+	repo := m["repo"]
+	if repo == "" {
+		repo = ctx.repo
+	} else if scheme := m["scheme"]; scheme != "" {
+		repo = scheme + "://" + repo
+	}
+	env := ctx.environ(v, dir)
+	args, sshEnv := ctx.sshOptions(v, env, repo, args)
+
+	// The command line is only ever reported, so redact it once here.
+	cmdStr := redact(v.cmd + " " + strings.Join(args, " "))
 	_, err := exec.LookPath(v.cmd)
 	if err != nil {
-		fmt.Fprintf(os.Stderr,
-			"go: missing %s command. See https://golang.org/s/gogetcmd\n",
-			v.name)
-		return nil, err
+		ctx.log(LevelError, "missing VCS command; see https://golang.org/s/gogetcmd",
+			"vcs", v.name, "cmd", v.cmd)
+		return nil, newError(ctx.importPath, cmdStr, err)
 	}
 
 	cmd := exec.Command(v.cmd, args...)
 	// dir defaults to ctx.dir but will be overridden if the command starts with `-go-internal-cd`
 	cmd.Dir = dir
-	cmd.Env = envForDir(cmd.Dir, os.Environ())
+	cmd.Env = append(env, sshEnv...)
+	credEnv, err := ctx.credentialEnv(v, cmd.Env, repo)
+	if err != nil {
+		return nil, newError(ctx.importPath, cmdStr, err)
+	}
+	cmd.Env = append(cmd.Env, credEnv...)
+	askEnv, stopAsk, err := ctx.startAskpass()
+	if err != nil {
+		return nil, newError(ctx.importPath, cmdStr, err)
+	}
+	defer stopAsk()
+	cmd.Env = append(cmd.Env, askEnv...)
+
+	// Collect stderr ourselves rather than letting cmd.Output do it,
+	// so that progress can be parsed from it as it arrives.
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if m["progress"] != "" {
+		cmd.Stderr = io.MultiWriter(&stderr, &progressWriter{
+			ctx:  ctx,
+			base: Event{VCS: v.cmd, Repo: m["repo"], Dir: dir},
+		})
+	}
+	// Output passed on to the caller has credentials redacted.
+	var tees []io.Writer
+	if ctx.stderr != nil {
+		tees = append(tees, ctx.stderr)
+	}
+	if ctx.interactive != nil && ctx.interactive.Stderr != nil {
+		tees = append(tees, ctx.interactive.Stderr)
+	}
+	var tee *redactWriter
+	if len(tees) > 0 {
+		tee = &redactWriter{w: io.MultiWriter(tees...)}
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, tee)
+	}
 
+	start := time.Now()
 	out, err := cmd.Output()
-	if err != nil {
-		if verbose {
-			fmt.Fprintf(ctx.stderr, "# cd %s; %s %s\n", dir, v.cmd, strings.Join(args, " "))
-			if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
-				ctx.stderr.Write(ee.Stderr)
-			} else {
-				fmt.Fprintf(ctx.stderr, "%s\n", err.Error())
-			}
+	duration := time.Since(start)
+	if tee != nil {
+		_ = tee.Flush()
+	}
+	exitCode := 0
+	if ee, ok := err.(*exec.ExitError); ok {
+		ee.Stderr = []byte(redact(stderr.String()))
+		exitCode = ee.ExitCode()
+	} else if err != nil {
+		exitCode = -1
+	}
+
+	ctx.log(LevelDebug, "ran command",
+		"dir", dir, "cmd", cmdStr, "duration", duration, "exit", exitCode)
+	if err != nil && verbose {
+		detail := redact(strings.TrimSpace(stderr.String()))
+		if detail == "" {
+			detail = err.Error()
 		}
+		ctx.log(LevelError, "command failed",
+			"dir", dir, "cmd", cmdStr, "exit", exitCode, "output", detail)
+	}
+	if err != nil {
+		return out, newError(ctx.importPath, cmdStr, err)
 	}
-	return out, err
+	return out, nil
 }
 
 // ping pings to determine scheme to use.
-func (v *vcsCmd) ping(scheme, repo string, stderr io.Writer) error {
-	return v.runVerboseOnly(newCmdContext(".", stderr), v.pingCmd, "scheme", scheme, "repo", repo)
+func (v *vcsCmd) ping(ctx cmdContext, scheme, repo string) error {
+	return v.runVerboseOnly(ctx.withDir("."), v.pingCmd, "scheme", scheme, "repo", repo)
 }
 
 // create creates a new copy of repo in dir.
 // The parent of dir must exist; dir must not.
-func (v *vcsCmd) create(dir, repo string, stderr io.Writer) error {
+func (v *vcsCmd) create(ctx cmdContext, dir, repo string) error {
 	for _, cmd := range v.createCmd {
-		if err := v.run(newCmdContext(".", stderr), cmd, "dir", dir, "repo", repo); err != nil {
+		if err := v.run(ctx.withDir("."), cmd, "dir", dir, "repo", repo); err != nil {
 			return err
 		}
 	}
@@ -468,9 +669,9 @@ func (v *vcsCmd) create(dir, repo string, stderr io.Writer) error {
 }
 
 // download downloads any new changes for the repo in dir.
-func (v *vcsCmd) download(dir string, stderr io.Writer) error {
+func (v *vcsCmd) download(ctx cmdContext, dir string) error {
 	for _, cmd := range v.downloadCmd {
-		if err := v.run(newCmdContext(dir, stderr), cmd); err != nil {
+		if err := v.run(ctx.withDir(dir), cmd); err != nil {
 			return err
 		}
 	}
@@ -478,10 +679,10 @@ func (v *vcsCmd) download(dir string, stderr io.Writer) error {
 }
 
 // tags returns the list of available tags for the repo in dir.
-func (v *vcsCmd) tags(dir string, stderr io.Writer) ([]string, error) {
+func (v *vcsCmd) tags(ctx cmdContext, dir string) ([]string, error) {
 	var tags []string
 	for _, tc := range v.tagCmd {
-		out, err := v.runOutput(newCmdContext(dir, stderr), tc.cmd)
+		out, err := v.runOutput(ctx.withDir(dir), tc.cmd)
 		if err != nil {
 			return nil, err
 		}
@@ -493,17 +694,33 @@ func (v *vcsCmd) tags(dir string, stderr io.Writer) ([]string, error) {
 	return tags, nil
 }
 
+// revision returns the revision checked out in dir.
+func (v *vcsCmd) revision(ctx cmdContext, dir string) (string, error) {
+	if v.revisionCmd == "" {
+		return "", fmt.Errorf("revisions not supported for %s", v.name)
+	}
+	out, err := v.runOutput(ctx.withDir(dir), v.revisionCmd)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
 // tagSync syncs the repo in dir to the named tag,
 // which either is a tag returned by tags or is v.tagDefault.
-func (v *vcsCmd) tagSync(dir, tag string, stderr io.Writer) error {
+func (v *vcsCmd) tagSync(ctx cmdContext, dir, tag string) error {
 	if v.tagSyncCmd == nil {
 		return nil
 	}
-	cmdCtx := newCmdContext(dir, stderr)
+	cmdCtx := ctx.withDir(dir)
 	if tag != "" {
 		for _, tc := range v.tagLookupCmd {
 			out, err := v.runOutput(cmdCtx, tc.cmd, "tag", tag)
 			if err != nil {
+				// The lookup fails without output when no ref matches.
+				if e, ok := err.(*Error); ok && e.Kind == nil && len(out) == 0 {
+					e.Kind = ErrRefNotFound
+				}
 				return err
 			}
 			re := regexp.MustCompile(`(?m-s)` + tc.pattern)
@@ -535,12 +752,12 @@ func (v *vcsCmd) tagSync(dir, tag string, stderr io.Writer) error {
 // A vcsPath describes how to convert an import path into a
 // version control system and repository name.
 type vcsPath struct {
-	prefix         string                              // prefix this description applies to
-	regexp         *regexp.Regexp                      // compiled pattern for import path
-	repo           string                              // repository to use (expand with match of re)
-	vcs            string                              // version control system to use (expand with match of re)
-	check          func(match map[string]string) error // additional checks
-	schemelessRepo bool                                // if true, the repo pattern lacks a scheme
+	prefix         string                                              // prefix this description applies to
+	regexp         *regexp.Regexp                                      // compiled pattern for import path
+	repo           string                                              // repository to use (expand with match of re)
+	vcs            string                                              // version control system to use (expand with match of re)
+	check          func(ctx cmdContext, match map[string]string) error // additional checks
+	schemelessRepo bool                                                // if true, the repo pattern lacks a scheme
 }
 
 // vcsFromDir inspects dir and its parents to determine the
@@ -652,8 +869,8 @@ func httpPrefix(s string) string {
 
 // repoRootForImportPath analyzes importPath to determine the
 // version control system, and code repository to use.
-func repoRootForImportPath(importPath string, security web.SecurityMode, stderr io.Writer) (*repoRoot, error) {
-	rr, err := repoRootFromVCSPaths(importPath, security, vcsPaths, stderr)
+func repoRootForImportPath(ctx cmdContext, importPath string, security web.SecurityMode) (*repoRoot, error) {
+	rr, err := repoRootFromVCSPaths(ctx, importPath, security, vcsPaths)
 
 	// Should have been taken care of above, but make sure.
 	if err == nil && strings.Contains(importPath, "...") && strings.Contains(rr.Root, "...") {
@@ -668,7 +885,7 @@ var errUnknownSite = errors.New("dynamic lookup required to find mapping")
 
 // repoRootFromVCSPaths attempts to map importPath to a repoRoot
 // using the mappings defined in vcsPaths.
-func repoRootFromVCSPaths(importPath string, security web.SecurityMode, vcsPaths []*vcsPath, stderr io.Writer) (*repoRoot, error) {
+func repoRootFromVCSPaths(ctx cmdContext, importPath string, security web.SecurityMode, vcsPaths []*vcsPath) (*repoRoot, error) {
 	// A common error is to use https://packagepath because that's what
 	// hg and git require. Diagnose this helpfully.
 	if prefix := httpPrefix(importPath); prefix != "" {
@@ -704,8 +921,13 @@ func repoRootFromVCSPaths(importPath string, security web.SecurityMode, vcsPaths
 		if srv.repo != "" {
 			match["repo"] = expand(match, srv.repo)
 		}
+		if !srv.schemelessRepo {
+			if err := ctx.policy.checkCandidate(importPath, match["vcs"], match["repo"]); err != nil {
+				return nil, err
+			}
+		}
 		if srv.check != nil {
-			if err := srv.check(match); err != nil {
+			if err := srv.check(ctx, match); err != nil {
 				return nil, err
 			}
 		}
@@ -713,6 +935,9 @@ func repoRootFromVCSPaths(importPath string, security web.SecurityMode, vcsPaths
 		if vcs == nil {
 			return nil, fmt.Errorf("unknown version control system %q", match["vcs"])
 		}
+		if err := checkGOVCS(ctx, vcs, match["root"]); err != nil {
+			return nil, err
+		}
 		var repoURL string
 		if !srv.schemelessRepo {
 			repoURL = match["repo"]
@@ -721,15 +946,31 @@ func repoRootFromVCSPaths(importPath string, security web.SecurityMode, vcsPaths
 			repo := match["repo"]
 			if vcs.pingCmd != "" {
 				// If we know how to test schemes, scan to find one.
+				// Schemes the policy denies aren't tried; if it
+				// denies them all, nothing is contacted.
+				var denied error
+				tried := false
 				for _, s := range vcs.scheme {
 					if security == web.SecureOnly && !vcs.isSecureScheme(s) {
 						continue
 					}
-					if vcs.ping(s, repo, stderr) == nil {
+					if err := ctx.policy.checkCandidate(importPath, vcs.cmd, s+"://"+repo); err != nil {
+						if denied == nil {
+							denied = err
+						}
+						continue
+					}
+					tried = true
+					err := ctx.retry("ping", func() error { return vcs.ping(ctx, s, repo) })
+					ctx.emit(Event{Kind: EventSchemeProbe, VCS: vcs.cmd, Repo: repo, Scheme: s, Err: err})
+					if err == nil {
 						scheme = s
 						break
 					}
 				}
+				if !tried && denied != nil {
+					return nil, denied
+				}
 			}
 			repoURL = scheme + "://" + repo
 		}
@@ -883,7 +1124,7 @@ var vcsPaths = []*vcsPath{
 // noVCSSuffix checks that the repository name does not
 // end in .foo for any version control system foo.
 // The usual culprit is ".git".
-func noVCSSuffix(match map[string]string) error {
+func noVCSSuffix(ctx cmdContext, match map[string]string) error {
 	repo := match["repo"]
 	for _, vcs := range vcsList {
 		if strings.HasSuffix(repo, "."+vcs.cmd) {
@@ -895,8 +1136,8 @@ func noVCSSuffix(match map[string]string) error {
 
 // bitbucketVCS determines the version control system for a
 // Bitbucket repository, by using the Bitbucket API.
-func bitbucketVCS(match map[string]string) error {
-	if err := noVCSSuffix(match); err != nil {
+func bitbucketVCS(ctx cmdContext, match map[string]string) error {
+	if err := noVCSSuffix(ctx, match); err != nil {
 		return err
 	}
 
@@ -909,14 +1150,25 @@ func bitbucketVCS(match map[string]string) error {
 		Path:     expand(match, "/2.0/repositories/{bitname}"),
 		RawQuery: "fields=scm",
 	}
-	data, err := web.GetBytes(url)
+	var data []byte
+	err := ctx.retry("discovery", func() (err error) {
+		data, err = ctx.webClient().GetBytes(url)
+		return err
+	})
 	if err != nil {
 		if httpErr, ok := err.(*web.HTTPError); ok && httpErr.StatusCode == 403 {
 			// this may be a private repository. If so, attempt to determine which
 			// VCS it uses. See issue 5375.
 			root := match["root"]
 			for _, vcs := range []string{"git", "hg"} {
-				if vcsByCmd(vcs).ping("https", root, os.Stderr) == nil {
+				v := vcsByCmd(vcs)
+				if checkGOVCS(ctx, v, root) != nil {
+					continue
+				}
+				if ctx.policy.checkCandidate(match["import"], vcs, "https://"+root) != nil {
+					continue
+				}
+				if ctx.retry("ping", func() error { return v.ping(ctx, "https", root) }) == nil {
 					resp.SCM = vcs
 					break
 				}
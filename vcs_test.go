@@ -14,6 +14,12 @@ import (
 	"github.com/tilt-dev/go-get/internal/web"
 )
 
+func init() {
+	// GOVCS defaults to public:git|hg,private:all,
+	// which breaks many of these tests.
+	os.Setenv("GOVCS", "*:all")
+}
+
 // Test that RepoRootForImportPath determines the correct RepoRoot for a given importPath.
 // TODO(cmang): Add tests for SVN and BZR.
 func TestRepoRootForImportPath(t *testing.T) {
@@ -199,7 +205,7 @@ func TestRepoRootForImportPath(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		got, err := repoRootForImportPath(test.path, web.SecureOnly, os.Stderr)
+		got, err := repoRootForImportPath(newCmdContext(".", nil), test.path, web.SecureOnly)
 		want := test.want
 
 		if want == nil {